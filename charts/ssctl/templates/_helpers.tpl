@@ -60,3 +60,69 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+InfluxDB connection settings for the upload jobs
+*/}}
+{{- define "ssctl.influxdbEnv" -}}
+- name: INFLUXDB_URL
+  value: {{ .Values.Influxdb.url | quote }}
+- name: INFLUXDB_VERSION
+  value: {{ .Values.Influxdb.version | quote }}
+- name: INFLUXDB_PRECISION
+  value: {{ .Values.Influxdb.precision | quote }}
+- name: INFLUXDB_GZIP
+  value: {{ .Values.Influxdb.gzip | quote }}
+{{- if eq (toString .Values.Influxdb.version) "2" }}
+- name: INFLUXDB_ORG
+  value: {{ .Values.Influxdb.org | quote }}
+- name: INFLUXDB_BUCKET
+  value: {{ .Values.Influxdb.bucket | quote }}
+{{- with .Values.Influxdb.tokenSecret }}
+{{- if .name }}
+- name: INFLUXDB_TOKEN
+  valueFrom:
+    secretKeyRef:
+      name: {{ .name }}
+      key: {{ .key }}
+{{- end }}
+{{- end }}
+{{- else }}
+{{- with .Values.Influxdb.database }}
+- name: INFLUXDB_DB
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.Influxdb.retentionPolicy }}
+- name: INFLUXDB_RP
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.Influxdb.username }}
+- name: INFLUXDB_USERNAME
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.Influxdb.passwordSecret }}
+{{- if .name }}
+- name: INFLUXDB_PASSWORD
+  valueFrom:
+    secretKeyRef:
+      name: {{ .name }}
+      key: {{ .key }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+Locate the secrets: the namespace, the release namespace when set empty, the
+secret names and the Sunsynk accounts, each with its own secrets named with
+the account as a suffix, e.g. sunsynk-token-<account>.
+*/}}
+{{- define "ssctl.kubeArgs" -}}
+- --namespace={{ .Values.kubernetes.namespace | default .Release.Namespace }}
+- --credentials-secret={{ .Values.kubernetes.secrets.credentials }}
+- --token-secret={{ .Values.kubernetes.secrets.token }}
+- --plants-secret={{ .Values.kubernetes.secrets.plants }}
+{{- with .Values.accounts }}
+- --account={{ join "," . }}
+{{- end }}
+{{- end }}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"ssctl/pkg/config"
+	"ssctl/pkg/metrics"
+	"ssctl/pkg/tokencache"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Account is one Sunsynk login with the plants selected from it.
+//
+// The default account has no name: its login comes from SS_USER, SS_PASS and
+// SS_TOKEN, or its credential and token stores, and its readings carry no
+// account label. Named accounts are listed in the config profile, or with
+// --k8s given by --account alone, and keep their token in a cache or secrets
+// of their own: tokens/<name>.json next to the default token cache, in
+// Kubernetes the secrets named with the account as a suffix, e.g.
+// sunsynk-token-<name>, and in Vault the path below $SS_VAULT_PATH named
+// after the account.
+type Account struct {
+	Name            string
+	User            string
+	Password        string
+	Token           string
+	RefreshToken    string
+	TokenCache      string
+	TokenPassphrase string
+
+	// Plants, when set, replaces the plant selection of the command.
+	Plants *PlantSelector
+}
+
+// configAccounts are the accounts of the config profile and accounts the
+// ones selected with --account, both set before any command runs.
+var (
+	configAccounts []Account
+	accounts       = []Account{{}}
+)
+
+// newConfigAccounts returns the accounts of a profile. Their own plants are
+// only used when usePlants is set, that is when the plants were not selected
+// with flags or SS_PLANT_ID.
+func newConfigAccounts(profile config.Profile, usePlants bool) []Account {
+
+	var list []Account
+
+	for _, a := range profile.Accounts {
+
+		account := Account{
+			Name:            a.Name,
+			User:            a.User,
+			Password:        a.Password,
+			Token:           a.Token,
+			RefreshToken:    a.RefreshToken,
+			TokenCache:      a.TokenCache,
+			TokenPassphrase: a.TokenPassphrase,
+		}
+
+		plants := PlantSelector{IDs: a.Plants.IDs, Names: a.Plants.Names, All: a.Plants.All}
+		if usePlants && !plants.Empty() {
+			account.Plants = &plants
+		}
+
+		list = append(list, account)
+	}
+
+	return list
+}
+
+// selectAccounts returns the accounts named by --account, every configured
+// account when none is named, or the default account without any. In
+// Kubernetes mode an account does not need to be configured, as its login
+// is read from its own secrets.
+func selectAccounts(configured []Account, names []string, k8s bool) ([]Account, error) {
+
+	if len(names) == 0 {
+		if len(configured) == 0 {
+			return []Account{{}}, nil
+		}
+		return configured, nil
+	}
+
+	var selected []Account
+
+	for _, name := range names {
+
+		name = strings.TrimSpace(name)
+		found := false
+
+		for _, account := range configured {
+			if account.Name == name {
+				selected = append(selected, account)
+				found = true
+				break
+			}
+		}
+
+		if found {
+			continue
+		}
+		if !k8s {
+			return nil, fmt.Errorf("account %q not found in the config profile", name)
+		}
+
+		selected = append(selected, Account{Name: name})
+	}
+
+	return selected, nil
+}
+
+// multiAccount reports whether named accounts are in use, in which case the
+// account is shown next to every result.
+func multiAccount() bool {
+	return len(accounts) != 1 || accounts[0].Name != ""
+}
+
+// String names the account in log messages.
+func (a Account) String() string {
+
+	if a.Name == "" {
+		return "default"
+	}
+
+	return a.Name
+}
+
+// tokenCache returns the local token cache of the account, encrypted when a
+// passphrase is set for it or in SS_TOKEN_PASSPHRASE.
+func (a Account) tokenCache() tokencache.FileStore {
+
+	if a.Name == "" {
+		return newTokenCache()
+	}
+
+	path := a.TokenCache
+	if path == "" {
+		var err error
+		if path, err = tokencache.AccountPath(a.Name); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	passphrase := a.TokenPassphrase
+	if passphrase == "" {
+		passphrase = os.Getenv("SS_TOKEN_PASSPHRASE")
+	}
+
+	return tokencache.FileStore{Path: path, Passphrase: passphrase}
+}
+
+// selector returns the plant selection to use with the account. Named
+// accounts without a selection use every plant.
+func (a Account) selector(sel PlantSelector) PlantSelector {
+
+	if a.Plants != nil {
+		return *a.Plants
+	}
+	if a.Name != "" && sel.Empty() {
+		return PlantSelector{All: true}
+	}
+
+	return sel
+}
+
+// label sets the account of records read from it.
+func (a Account) label(records []Record) []Record {
+
+	for i := range records {
+		records[i].Account = a.Name
+	}
+
+	return records
+}
+
+// labels returns labels with the account added, unless it is the default
+// account.
+func (a Account) labels(labels metrics.Labels) metrics.Labels {
+
+	if a.Name == "" {
+		return labels
+	}
+
+	return withLabel(labels, "account", a.Name)
+}
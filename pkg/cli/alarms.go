@@ -0,0 +1,368 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssctl/pkg/lineprotocol"
+	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// alarmsCmd groups the alarm commands
+var alarmsCmd = &cobra.Command{
+	Use:   "alarms",
+	Short: "Inverter alarms and fault events",
+}
+
+// alarmsListCmd lists the alarms raised since a point in time
+var alarmsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the alarms raised by the inverters of each plant",
+	Long: `List the faults, warnings and events raised by the inverters of each
+selected plant since --since, which is a duration (24h) or a date
+(2025-03-01) in the plant's timezone.
+
+The alarms are printed as a table unless --output says otherwise. With
+--upload they are written to
+InfluxDB as sunsynk_alarm events instead; alarms already written are
+recorded in the --state file and skipped, so polling does not report the
+same fault twice. An alarm is written again once it has recovered.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Root().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Root().PersistentFlags().GetBool("k8s")
+		uploadFlagValue, _ := cmd.Root().PersistentFlags().GetBool("upload")
+		tzFlagValue, _ := cmd.Flags().GetString("tz")
+		sinceFlagValue, _ := cmd.Flags().GetString("since")
+		inverterFlagValue, _ := cmd.Flags().GetStringSlice("inverter")
+		stateFlagValue, _ := cmd.Flags().GetString("state")
+		format := outputFormatFromFlags(cmd, OutputTable)
+
+		alarms := Alarms(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), tzFlagValue, sinceFlagValue, inverterFlagValue)
+
+		if !uploadFlagValue {
+			printOutput(format, alarms, alarmTable)
+			return
+		}
+
+		if stateFlagValue == "" {
+			path, err := defaultStatePath("alarms.json")
+			if err != nil {
+				log.Fatal(err)
+			}
+			stateFlagValue = path
+		}
+
+		state, err := loadAlarmState(stateFlagValue)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fresh := state.fresh(alarms)
+
+		lines, err := Alarms2Line(fresh)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(lines) > 0 {
+			Upload2influxdb(cmd.Context(), strings.Join(lines, "\n"))
+		}
+
+		pruneBefore, err := alarmPruneTime(sinceFlagValue, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		state.mark(fresh)
+		state.prune(pruneBefore)
+		if err := state.save(stateFlagValue); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Reported %d new alarms", len(fresh))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(alarmsCmd)
+	alarmsCmd.AddCommand(alarmsListCmd)
+	addPlantSelectorFlags(alarmsCmd.PersistentFlags())
+	alarmsCmd.PersistentFlags().String("tz", "", "IANA timezone of the plants, e.g. Europe/London (default: from the plant settings)")
+	alarmsListCmd.Flags().String("since", "24h", "Duration (24h) or date (2025-03-01) to list alarms from")
+	alarmsListCmd.Flags().StringSlice("inverter", nil, "Only these inverter serial numbers, may be repeated or comma separated")
+	alarmsListCmd.Flags().String("state", "", "File recording the alarms already uploaded (default: alarms.json under $XDG_STATE_HOME/ssctl)")
+}
+
+// PlantAlarm is an alarm together with the plant it was raised in and the
+// account the plant belongs to.
+type PlantAlarm struct {
+	Account   string             `json:"account,omitempty"`
+	PlantId   int                `json:"plant_id"`
+	PlantName string             `json:"plant_name,omitempty"`
+	Time      time.Time          `json:"time"`
+	Alarm     sunsynk.SSApiAlarm `json:"alarm"`
+}
+
+// Alarms returns the alarms of every selected plant raised since since,
+// oldest first. inverters, when not empty, limits them to those inverters.
+func Alarms(ctx context.Context, k8s bool, sel PlantSelector, tz, since string, inverters []string) []PlantAlarm {
+
+	var alarms []PlantAlarm
+
+	for _, account := range accounts {
+
+		client := NewAuthenticatedClient(account, k8s)
+
+		for _, plant := range GetPlants(ctx, client, account, k8s, sel) {
+
+			loc := PlantLocation(ctx, client, plant.Id, tz)
+
+			start, err := parseSince(since, time.Now(), loc)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			found, err := plantAlarms(ctx, client, account, plant, loc, start, inverters)
+			if err != nil {
+				FatalAPIError(err)
+			}
+
+			alarms = append(alarms, found...)
+		}
+	}
+
+	// Each plant's alarms are in order already; interleave the plants.
+	sort.SliceStable(alarms, func(i, j int) bool { return alarms[i].Time.Before(alarms[j].Time) })
+
+	return alarms
+}
+
+// plantAlarms fetches the alarms of a plant of account raised since since,
+// from the plant's list or, when inverters is not empty, from the list of
+// each one.
+func plantAlarms(ctx context.Context, client *sunsynk.Client, account Account, plant sunsynk.SSApiUserPlant, loc *time.Location, since time.Time, inverters []string) ([]PlantAlarm, error) {
+
+	from := since.In(loc).Format("2006-01-02")
+	to := time.Now().In(loc).Format("2006-01-02")
+
+	var iterators []*sunsynk.Iterator[sunsynk.SSApiAlarm]
+	if len(inverters) == 0 {
+		iterators = append(iterators, client.PlantAlarms(strconv.Itoa(plant.Id), from, to))
+	}
+	for _, sn := range inverters {
+		iterators = append(iterators, client.InverterAlarms(strings.TrimSpace(sn), from, to))
+	}
+
+	var alarms []PlantAlarm
+
+	for _, it := range iterators {
+
+		found, err := sunsynk.Collect(ctx, it)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, alarm := range found {
+
+			t, err := time.ParseInLocation("2006-01-02 15:04:05", alarm.Time, loc)
+			if err != nil {
+				return nil, fmt.Errorf("plant %d alarm %d: invalid time %q", plant.Id, alarm.Id, alarm.Time)
+			}
+			if t.Before(since) {
+				continue
+			}
+
+			alarms = append(alarms, PlantAlarm{
+				Account:   account.Name,
+				PlantId:   plant.Id,
+				PlantName: plant.Name,
+				Time:      t,
+				Alarm:     alarm,
+			})
+		}
+	}
+
+	sort.SliceStable(alarms, func(i, j int) bool { return alarms[i].Time.Before(alarms[j].Time) })
+
+	return alarms, nil
+}
+
+// parseSince reads --since: a duration back from now, or a date or RFC 3339
+// time in loc.
+func parseSince(since string, now time.Time, loc *time.Location) (time.Time, error) {
+
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", since, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid --since %q, expected a duration such as 24h or a date such as 2025-03-01", since)
+}
+
+// Alarms2Line converts alarms into sunsynk_alarm events, timestamped when
+// the alarm was raised. The recovered version of an alarm overwrites the
+// active one.
+func Alarms2Line(alarms []PlantAlarm) ([]string, error) {
+
+	points := make([]lineprotocol.Point, 0, len(alarms))
+
+	for _, a := range alarms {
+		points = append(points, lineprotocol.Point{
+			Measurement: "sunsynk_alarm",
+			Tags: []lineprotocol.Tag{
+				{Key: "account", Value: a.Account},
+				{Key: "plant", Value: strconv.Itoa(a.PlantId)},
+				{Key: "plant_name", Value: a.PlantName},
+				{Key: "inverter", Value: a.Alarm.Sn},
+				{Key: "code", Value: string(a.Alarm.Code)},
+				{Key: "level", Value: a.Alarm.Level.String()},
+			},
+			Fields: []lineprotocol.Field{
+				{Key: "id", Value: a.Alarm.Id},
+				{Key: "status", Value: a.Alarm.Status.String()},
+				{Key: "message", Value: a.Alarm.Message()},
+			},
+			Time: a.Time,
+		})
+	}
+
+	return lineEncoder().EncodeAll(points)
+}
+
+// alarmTable lays alarms out for the csv, table and line outputs.
+var alarmTable = outputTable[PlantAlarm]{
+	columns: []string{"time", "plant_id", "plant_name", "inverter", "code", "level", "status", "message"},
+	row: func(a PlantAlarm) []string {
+		return []string{
+			a.Time.Format(time.RFC3339), strconv.Itoa(a.PlantId), a.PlantName, a.Alarm.Sn,
+			string(a.Alarm.Code), a.Alarm.Level.String(), a.Alarm.Status.String(), a.Alarm.Message(),
+		}
+	},
+	account: func(a PlantAlarm) string { return a.Account },
+	lines:   Alarms2Line,
+}
+
+// alarmStateRetention is how long reported alarms are remembered at least.
+// Those raised within a longer --since window are kept for as long as it
+// reaches back, or they would be reported again.
+const alarmStateRetention = 31 * 24 * time.Hour
+
+// alarmPruneTime returns the time before which reported alarms can be
+// forgotten: the start of the --since window or the retention, whichever is
+// earlier.
+func alarmPruneTime(since string, now time.Time) (time.Time, error) {
+
+	// --since dates are read in the timezone of each plant, and midnight
+	// at the easternmost offset, UTC+14, comes before all of them.
+	start, err := parseSince(since, now, time.FixedZone("UTC+14", 14*60*60))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if retained := now.Add(-alarmStateRetention); retained.Before(start) {
+		return retained, nil
+	}
+
+	return start, nil
+}
+
+// alarmState records the alarms already reported, with the time each was
+// raised.
+type alarmState struct {
+	Reported map[string]time.Time `json:"reported"`
+}
+
+func loadAlarmState(path string) (*alarmState, error) {
+
+	state := &alarmState{Reported: map[string]time.Time{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("alarm state %s: %w", path, err)
+	}
+	if state.Reported == nil {
+		state.Reported = map[string]time.Time{}
+	}
+
+	return state, nil
+}
+
+// alarmKey identifies an alarm in one status, so that its recovery is
+// reported once more.
+func alarmKey(a PlantAlarm) string {
+
+	if a.Alarm.Id != 0 {
+		return fmt.Sprintf("%d/%d", a.Alarm.Id, a.Alarm.Status)
+	}
+
+	return fmt.Sprintf("%s/%s/%s/%d", a.Alarm.Sn, a.Alarm.Code, a.Alarm.Time, a.Alarm.Status)
+}
+
+// fresh returns the alarms not reported before.
+func (s *alarmState) fresh(alarms []PlantAlarm) []PlantAlarm {
+
+	var fresh []PlantAlarm
+
+	for _, a := range alarms {
+		if _, ok := s.Reported[alarmKey(a)]; !ok {
+			fresh = append(fresh, a)
+		}
+	}
+
+	return fresh
+}
+
+// mark records alarms as reported.
+func (s *alarmState) mark(alarms []PlantAlarm) {
+	for _, a := range alarms {
+		s.Reported[alarmKey(a)] = a.Time
+	}
+}
+
+// prune forgets the alarms raised before before.
+func (s *alarmState) prune(before time.Time) {
+	for key, t := range s.Reported {
+		if t.Before(before) {
+			delete(s.Reported, key)
+		}
+	}
+}
+
+func (s *alarmState) save(path string) error {
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(path, data, 0600)
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+
+	johannesburg, err := time.LoadLocation("Africa/Johannesburg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		since   string
+		want    string
+		wantErr bool
+	}{
+		{since: "24h", want: "2025-03-09T12:00:00Z"},
+		{since: "90m", want: "2025-03-10T10:30:00Z"},
+		{since: "2025-03-01", want: "2025-02-28T22:00:00Z"},
+		{since: "2025-03-01T06:00:00+01:00", want: "2025-03-01T05:00:00Z"},
+		{since: "yesterday", wantErr: true},
+		{since: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+
+		got, err := parseSince(tt.since, now, johannesburg)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseSince(%q) err = %v, want error %v", tt.since, err, tt.wantErr)
+		}
+		if err == nil && got.UTC().Format(time.RFC3339) != tt.want {
+			t.Errorf("parseSince(%q) = %s, want %s", tt.since, got.UTC().Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestAlarmPruneTime(t *testing.T) {
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		since string
+		want  string
+	}{
+		// Short windows keep the full retention.
+		{"24h", "2025-02-07T12:00:00Z"},
+		// Longer ones keep everything they report.
+		{"1000h", "2025-01-27T20:00:00Z"},
+		{"2025-01-01", "2024-12-31T10:00:00Z"},
+		{"2024-12-01T00:00:00Z", "2024-12-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+
+		got, err := alarmPruneTime(tt.since, now)
+		if err != nil {
+			t.Fatalf("alarmPruneTime(%q): %v", tt.since, err)
+		}
+		if s := got.UTC().Format(time.RFC3339); s != tt.want {
+			t.Errorf("alarmPruneTime(%q) = %s, want %s", tt.since, s, tt.want)
+		}
+	}
+
+	if _, err := alarmPruneTime("soon", now); err == nil {
+		t.Error("alarmPruneTime(\"soon\") did not fail")
+	}
+}
@@ -2,18 +2,14 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"os"
-	"ssctl/pkg/kube"
 	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/tokencache"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // authCmd represents the auth command
@@ -35,12 +31,60 @@ to quickly create a Cobra application.`,
 		}
 
 		k8sFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("k8s")
-		Auth(k8sFlagValue)
+		forceFlagValue, _ := cmd.Flags().GetBool("force")
+		format := outputFormatFromFlags(cmd, OutputJSON)
+		Auth(cmd.Context(), k8sFlagValue, forceFlagValue, format)
+	},
+}
+
+// authLoginCmd represents the auth login command
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in and store the token for later commands",
+	Long: `Log in with SS_USER and SS_PASS, or the credentials of --credential-store,
+and store the access and refresh token.
+
+Without --k8s the token is cached in $XDG_CONFIG_HOME/ssctl/token.json
+(override with SS_TOKEN_CACHE), readable only by the current user. Set
+SS_TOKEN_PASSPHRASE to encrypt the cache. Later commands pick the token up
+automatically and refresh it when it expires. With --token-store the token
+is kept in Kubernetes secrets or Vault instead.
+
+The named accounts of the config profile log in with their own user and
+password and are cached in tokens/<account>.json next to token.json.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Root().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Root().PersistentFlags().GetBool("k8s")
+		AuthLogin(cmd.Context(), k8sFlagValue)
+	},
+}
+
+// authLogoutCmd represents the auth logout command
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the locally cached tokens",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		for _, account := range accounts {
+			cache := account.tokenCache()
+			if err := cache.Remove(); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Removed token cache %s", cache.Path)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authLogoutCmd)
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -49,110 +93,126 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	// authCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	authCmd.Flags().Bool("force", false, "Always perform a full password login instead of refreshing the stored token")
 
 }
 
-func Auth(k8s bool) {
+// Auth logs in to each account with its credentials and prints the tokens
+// in format, or in Kubernetes mode keeps their token secrets fresh:
+// the stored token is refreshed shortly before it expires and a full
+// password login only happens when the refresh fails or force is set.
+func Auth(ctx context.Context, k8s, force bool, format OutputFormat) {
 
-	var GetNewAuthTokenResponse sunsynk.SSApiNewTokenResponse
+	if !k8s {
 
-	namespace := os.Getenv("SS_NAMESPACE")
-	if namespace == "" {
-		namespace = "sunsynk"
-	}
+		var tokens []AuthTokenOutput
 
-	if !k8s {
+		for _, account := range accounts {
 
-		SunsynkUser := os.Getenv("SS_USER")
-		SunsynkPass := os.Getenv("SS_PASS")
+			SunsynkUser, SunsynkPass, err := credentialStore(account, k8s).Credentials(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
 
-		if SunsynkUser == "" || SunsynkPass == "" {
-			log.Fatal("No credentials found in env")
-		}
+			GetNewAuthTokenResponse, err := NewClient(nil).Login(ctx, SunsynkUser, SunsynkPass)
+			if err != nil {
+				FatalAPIError(err)
+			}
 
-		GetNewAuthTokenResponse, err := sunsynk.GetNewAuthToken(string(SunsynkUser), string(SunsynkPass))
-		if err != nil {
-			log.Fatal(err)
-		}
+			token := NewAuthTokenOutput(sunsynk.NewAuthToken(GetNewAuthTokenResponse, time.Now()))
+			token.Account = account.Name
 
-		TokenJson, err := json.Marshal(GetNewAuthTokenResponse)
-		if err != nil {
-			log.Fatal(err)
+			tokens = append(tokens, token)
 		}
 
-		fmt.Println(string(TokenJson))
+		printOutput(format, tokens, authTokenTable)
 
 	} else {
 
-		clientset, err := kube.Login()
-		if err != nil {
-			log.Fatal(err)
-		}
+		for _, account := range accounts {
 
-		// Get the "default" namespace
+			client := NewClient(nil)
+			source := NewTokenSource(client, account, k8s)
 
-		// Get the credential secret
-		result, err := kube.GetK8sSecret(clientset, "sunsynk-credentials", namespace)
-		if err != nil {
-			log.Fatal(err)
-		}
+			var token sunsynk.SSAuthToken
+			var err error
 
-		username, ok := result.Data["username"]
-		if !ok {
-			log.Fatal("username not found in secret data")
-		}
+			if force {
+				token, err = source.Login(ctx)
+			} else {
+				token, err = source.AuthToken(ctx)
+			}
+			if err != nil {
+				FatalAPIError(err)
+			}
 
-		password, ok := result.Data["password"]
-		if !ok {
-			log.Fatal("password not found in secret data")
+			if expiry, ok := token.ExpiresAt(); ok {
+				log.Printf("Token of account %s valid until %s", account, expiry.UTC().Format(time.RFC3339))
+			}
 		}
+	}
+}
+
+// AuthLogin performs a full password login to each account and saves the
+// tokens to their local token cache, or to their token secret in
+// Kubernetes mode.
+func AuthLogin(ctx context.Context, k8s bool) {
+
+	for _, account := range accounts {
+
+		source := NewTokenSource(NewClient(nil), account, k8s)
 
-		GetNewAuthTokenResponse, err = sunsynk.GetNewAuthToken(string(username), string(password))
+		token, err := source.Login(ctx)
 		if err != nil {
-			log.Fatal(err)
+			FatalAPIError(err)
 		}
 
-		// Create a new secret
-		SunsynkTokenSecret := &corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "sunsynk-token",
-				Namespace: namespace,
-			},
-			Type: "Opaque",
-			Data: map[string][]byte{
-				"token":     []byte(GetNewAuthTokenResponse.Data.AccessToken),
-				"type":      []byte(GetNewAuthTokenResponse.Data.TokenType),
-				"refresh":   []byte(GetNewAuthTokenResponse.Data.RefreshToken),
-				"expiry":    []byte(fmt.Sprint(GetNewAuthTokenResponse.Data.TokenExpiry)),
-				"scope":     []byte(GetNewAuthTokenResponse.Data.Scope),
-				"timestamp": []byte(fmt.Sprint(time.Now().Unix())),
-			},
+		if cache, ok := tokenStore(account, k8s).(tokencache.FileStore); ok {
+			log.Printf("Token of account %s cached in %s", account, cache.Path)
 		}
 
-		// Get the secret
-		result, err = kube.GetK8sSecret(clientset, "sunsynk-token", "sunsynk")
-		if err != nil {
-			//Create the secret
-			result, err = clientset.CoreV1().Secrets(namespace).Create(context.Background(), SunsynkTokenSecret, metav1.CreateOptions{})
-			if err != nil {
-				log.Fatal(err)
-			}
-			log.Printf("Created secret %q.\n", result.GetObjectMeta().GetName())
-		} else {
-			// Update the secret
-			result.Data["token"] = []byte(GetNewAuthTokenResponse.Data.AccessToken)
-			result.Data["type"] = []byte(GetNewAuthTokenResponse.Data.TokenType)
-			result.Data["refresh"] = []byte(GetNewAuthTokenResponse.Data.RefreshToken)
-			result.Data["expiry"] = []byte(fmt.Sprint(GetNewAuthTokenResponse.Data.TokenExpiry))
-			result.Data["scope"] = []byte(GetNewAuthTokenResponse.Data.Scope)
-			result.Data["timestamp"] = []byte(fmt.Sprint(time.Now().Unix()))
-
-			_, err = clientset.CoreV1().Secrets(namespace).Update(context.Background(), result, metav1.UpdateOptions{})
-			if err != nil {
-				log.Fatal(err)
-			}
-			log.Printf("Updated secret %q.\n", result.GetObjectMeta().GetName())
+		if expiry, ok := token.ExpiresAt(); ok {
+			log.Printf("Token of account %s valid until %s", account, expiry.UTC().Format(time.RFC3339))
 		}
 	}
 }
+
+// AuthTokenOutput is the token printed by auth.
+type AuthTokenOutput struct {
+	Account      string     `json:"account,omitempty"`
+	AccessToken  string     `json:"access_token"`
+	TokenType    string     `json:"token_type"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	Scope        string     `json:"scope,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// NewAuthTokenOutput returns the printable form of token.
+func NewAuthTokenOutput(token sunsynk.SSAuthToken) AuthTokenOutput {
+
+	out := AuthTokenOutput{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Scope:        token.Scope,
+	}
+	if expiry, ok := token.ExpiresAt(); ok {
+		expiry = expiry.UTC()
+		out.ExpiresAt = &expiry
+	}
+
+	return out
+}
+
+// authTokenTable lays the token out for the csv and table outputs.
+var authTokenTable = outputTable[AuthTokenOutput]{
+	columns: []string{"access_token", "token_type", "refresh_token", "scope", "expires_at"},
+	row: func(t AuthTokenOutput) []string {
+		expiresAt := ""
+		if t.ExpiresAt != nil {
+			expiresAt = t.ExpiresAt.Format(time.RFC3339)
+		}
+		return []string{t.AccessToken, t.TokenType, t.RefreshToken, t.Scope, expiresAt}
+	},
+	account: func(t AuthTokenOutput) string { return t.Account },
+}
@@ -0,0 +1,364 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// backfillCmd fetches the day chart of every day in a date range
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Fetch plant data for a range of past days",
+	Long: `Fetch the day chart of the selected plants for every day from --from to
+--to (inclusive) and write it to InfluxDB with --upload, or to stdout.
+
+Days are fetched concurrently. With --upload every uploaded day is recorded
+in a checkpoint file, so a backfill that fails part way can simply be run
+again and continues with the days that are still missing. The current day of
+a plant is never recorded, as its chart is still filling up. Without --upload
+the checkpoint is neither read nor written, so a preview does not stop the
+days from being uploaded later.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Parent().Parent().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Parent().Parent().PersistentFlags().GetBool("k8s")
+		uploadFlagValue, _ := cmd.Parent().Parent().PersistentFlags().GetBool("upload")
+		tzFlagValue, _ := cmd.Flags().GetString("tz")
+
+		var opts BackfillOptions
+		opts.From, _ = cmd.Flags().GetString("from")
+		opts.To, _ = cmd.Flags().GetString("to")
+		opts.Concurrency, _ = cmd.Flags().GetInt("concurrency")
+		opts.Checkpoint, _ = cmd.Flags().GetString("checkpoint")
+		opts.Reset, _ = cmd.Flags().GetBool("reset")
+
+		if opts.Checkpoint == "" && uploadFlagValue {
+			path, err := defaultStatePath("backfill.json")
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.Checkpoint = path
+		}
+
+		sink := func(ctx context.Context, data string) error {
+			fmt.Println(data)
+			return nil
+		}
+		if uploadFlagValue {
+			sink = NewInfluxWriter().Write
+		} else {
+			if opts.Checkpoint != "" {
+				log.Warn("Ignoring --checkpoint without --upload")
+			}
+			opts.Checkpoint = ""
+		}
+
+		err := Backfill(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), tzFlagValue, opts, sink)
+		if err != nil {
+			if opts.Checkpoint != "" {
+				log.Errorf("Backfill stopped, run the same command again to resume from %s", opts.Checkpoint)
+			}
+			FatalAPIError(err)
+		}
+
+	},
+}
+
+func init() {
+	plantCmd.AddCommand(backfillCmd)
+	backfillCmd.Flags().String("from", "", "First day to fetch, e.g. 2025-01-01")
+	backfillCmd.Flags().String("to", "", "Last day to fetch, e.g. 2025-12-31")
+	backfillCmd.Flags().Int("concurrency", 4, "Number of days fetched at the same time")
+	backfillCmd.Flags().String("checkpoint", "", "Checkpoint file recording uploaded days (default: backfill.json under $XDG_STATE_HOME/ssctl)")
+	backfillCmd.Flags().Bool("reset", false, "Ignore the checkpoint and fetch every day again")
+	backfillCmd.MarkFlagRequired("from")
+	backfillCmd.MarkFlagRequired("to")
+}
+
+// BackfillOptions controls a backfill run.
+type BackfillOptions struct {
+	From        string
+	To          string
+	Concurrency int
+	// Checkpoint is the checkpoint file, or empty to fetch every day and
+	// record none.
+	Checkpoint string
+	Reset      bool
+}
+
+// backfillDay is one day of one plant, fetched by a backfill worker with
+// the client of the plant's account.
+type backfillDay struct {
+	account   Account
+	client    *sunsynk.Client
+	plantId   int
+	plantName string
+	loc       *time.Location
+	date      string
+	// over is set when the day has ended in the plant's timezone, and so
+	// can be checkpointed.
+	over  bool
+	lines []string
+	err   error
+}
+
+// Backfill fetches the day chart of every selected plant for each day from
+// opts.From to opts.To and passes each day to sink as soon as it arrives.
+// Days already in the checkpoint are skipped, and days passed to sink are
+// added to it. The first error stops the run after the days in flight have
+// finished.
+func Backfill(ctx context.Context, k8s bool, sel PlantSelector, tz string, opts BackfillOptions, sink func(context.Context, string) error) error {
+
+	dates, err := dateRange(opts.From, opts.To)
+	if err != nil {
+		return err
+	}
+
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	checkpoint := &backfillCheckpoint{Plants: map[string][]string{}}
+	if !opts.Reset && opts.Checkpoint != "" {
+		checkpoint, err = loadCheckpoint(opts.Checkpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	var pending []backfillDay
+
+	for _, account := range accounts {
+
+		client := NewAuthenticatedClient(account, k8s)
+
+		for _, plant := range GetPlants(ctx, client, account, k8s, sel) {
+
+			loc := PlantLocation(ctx, client, plant.Id, tz)
+			today := time.Now().In(loc).Format("2006-01-02")
+
+			for _, date := range checkpoint.missing(account, plant.Id, dates) {
+				pending = append(pending, backfillDay{account: account, client: client, plantId: plant.Id, plantName: plant.Name, loc: loc, date: date, over: date < today})
+			}
+		}
+	}
+
+	log.Infof("Backfilling %d plant days from %s to %s", len(pending), opts.From, opts.To)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan backfillDay)
+	results := make(chan backfillDay)
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for day := range jobs {
+				results <- fetchBackfillDay(ctx, day)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, day := range pending {
+			select {
+			case jobs <- day:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	completed := 0
+
+	for day := range results {
+
+		if firstErr != nil {
+			continue
+		}
+
+		err := day.err
+		if err == nil && len(day.lines) > 0 {
+			err = sink(ctx, strings.Join(day.lines, "\n"))
+		}
+		if err == nil && day.over && opts.Checkpoint != "" {
+			checkpoint.add(day.account, day.plantId, day.date)
+			err = checkpoint.save(opts.Checkpoint)
+		}
+		if err != nil {
+			firstErr = fmt.Errorf("plant %d on %s: %w", day.plantId, day.date, err)
+			cancel()
+			continue
+		}
+
+		completed++
+		log.Debugf("Backfilled plant %d on %s (%d/%d)", day.plantId, day.date, completed, len(pending))
+	}
+
+	if firstErr == nil && ctx.Err() != nil && completed < len(pending) {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	log.Infof("Backfilled %d plant days", completed)
+
+	return nil
+}
+
+// fetchBackfillDay fetches and converts the day chart for day.
+func fetchBackfillDay(ctx context.Context, day backfillDay) backfillDay {
+
+	plantdata, err := day.client.GetPlantData(ctx, day.date, strconv.Itoa(day.plantId))
+	if err != nil {
+		day.err = err
+		return day
+	}
+
+	records, err := Plant2Records(day.date, day.plantId, day.plantName, day.loc, plantdata)
+	if err != nil {
+		day.err = err
+		return day
+	}
+
+	day.lines, day.err = EncodeRecords(day.account.label(records))
+
+	return day
+}
+
+// dateRange returns every date from from to to, inclusive.
+func dateRange(from, to string) ([]string, error) {
+
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --from date %q: %w", from, err)
+	}
+
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --to date %q: %w", to, err)
+	}
+
+	if end.Before(start) {
+		return nil, fmt.Errorf("--to %s is before --from %s", to, from)
+	}
+
+	var dates []string
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+
+	return dates, nil
+}
+
+// backfillCheckpoint records the days already backfilled, keyed by plant ID
+// for the default account and <account>/<plant ID> for named accounts, whose
+// plant IDs may overlap.
+type backfillCheckpoint struct {
+	Plants map[string][]string `json:"plants"`
+}
+
+func loadCheckpoint(path string) (*backfillCheckpoint, error) {
+
+	checkpoint := &backfillCheckpoint{Plants: map[string][]string{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if checkpoint.Plants == nil {
+		checkpoint.Plants = map[string][]string{}
+	}
+
+	return checkpoint, nil
+}
+
+func checkpointKey(account Account, plantId int) string {
+
+	if account.Name == "" {
+		return strconv.Itoa(plantId)
+	}
+
+	return account.Name + "/" + strconv.Itoa(plantId)
+}
+
+func (c *backfillCheckpoint) done(account Account, plantId int, date string) bool {
+
+	dates := c.Plants[checkpointKey(account, plantId)]
+	i := sort.SearchStrings(dates, date)
+
+	return i < len(dates) && dates[i] == date
+}
+
+// missing returns the dates a plant still has to be backfilled for.
+func (c *backfillCheckpoint) missing(account Account, plantId int, dates []string) []string {
+
+	var missing []string
+	for _, date := range dates {
+		if !c.done(account, plantId, date) {
+			missing = append(missing, date)
+		}
+	}
+
+	return missing
+}
+
+func (c *backfillCheckpoint) add(account Account, plantId int, date string) {
+
+	if c.done(account, plantId, date) {
+		return
+	}
+
+	key := checkpointKey(account, plantId)
+	c.Plants[key] = append(c.Plants[key], date)
+	sort.Strings(c.Plants[key])
+}
+
+// save replaces the checkpoint file atomically so that an interrupted run
+// never leaves it half written.
+func (c *backfillCheckpoint) save(path string) error {
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(path, data, 0600)
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBackfillCheckpoint(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "backfill.json")
+	dates := []string{"2025-01-01", "2025-01-02", "2025-01-03", "2025-01-04"}
+
+	defaultAccount := Account{}
+	acme := Account{Name: "acme"}
+
+	// A missing checkpoint is empty.
+	checkpoint, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := checkpoint.missing(defaultAccount, 1, dates); !reflect.DeepEqual(got, dates) {
+		t.Errorf("missing = %v, want every date", got)
+	}
+
+	// A first run gets through two days, out of order, before it stops.
+	checkpoint.add(defaultAccount, 1, "2025-01-03")
+	checkpoint.add(defaultAccount, 1, "2025-01-01")
+	checkpoint.add(defaultAccount, 1, "2025-01-01")
+	checkpoint.add(acme, 1, "2025-01-02")
+	if err := checkpoint.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next run resumes with the days still missing, per account.
+	resumed, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		account Account
+		plantId int
+		want    []string
+	}{
+		{defaultAccount, 1, []string{"2025-01-02", "2025-01-04"}},
+		{acme, 1, []string{"2025-01-01", "2025-01-03", "2025-01-04"}},
+		{defaultAccount, 2, dates},
+	}
+	for _, tt := range tests {
+		if got := resumed.missing(tt.account, tt.plantId, dates); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("missing(%q, %d) = %v, want %v", tt.account.Name, tt.plantId, got, tt.want)
+		}
+	}
+
+	want := map[string][]string{
+		"1":      {"2025-01-01", "2025-01-03"},
+		"acme/1": {"2025-01-02"},
+	}
+	if !reflect.DeepEqual(resumed.Plants, want) {
+		t.Errorf("checkpoint = %v, want %v", resumed.Plants, want)
+	}
+}
+
+func TestLoadCheckpointInvalid(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "backfill.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadCheckpoint(path); err == nil {
+		t.Error("loading an invalid checkpoint did not fail")
+	}
+}
+
+func TestDateRange(t *testing.T) {
+
+	got, err := dateRange("2024-02-28", "2024-03-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2024-02-28", "2024-02-29", "2024-03-01"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dateRange = %v, want %v", got, want)
+	}
+
+	for _, r := range [][2]string{{"2024-03-01", "2024-02-28"}, {"2024-13-01", "2024-12-31"}, {"2024-01-01", "tomorrow"}} {
+		if _, err := dateRange(r[0], r[1]); err == nil {
+			t.Errorf("dateRange(%s, %s) did not fail", r[0], r[1])
+		}
+	}
+}
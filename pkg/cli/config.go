@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"ssctl/pkg/config"
+
+	"github.com/spf13/cobra"
+)
+
+// applyConfig loads the configuration file and fills in, from the selected
+// profile, the flags and environment variables that were not given: flags
+// win over the environment, which wins over the profile.
+func applyConfig(cmd *cobra.Command) error {
+
+	path, _ := cmd.Flags().GetString("config")
+	if path == "" {
+		path = os.Getenv("SSCTL_CONFIG")
+	}
+	required := path != ""
+
+	if path == "" {
+		var err error
+		if path, err = config.DefaultPath(); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := config.Load(path, required)
+	if err != nil {
+		return err
+	}
+
+	name, _ := cmd.Flags().GetString("profile")
+	if name == "" {
+		name = os.Getenv("SSCTL_PROFILE")
+	}
+
+	profile, err := cfg.Profile(name)
+	if err != nil {
+		return err
+	}
+
+	// SS_PLANT_ID selects plants like the flags do, so it also overrides
+	// the plants of the profile.
+	_, plantEnv := os.LookupEnv("SS_PLANT_ID")
+
+	for key, value := range profile.Env() {
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+
+	setFlagDefault(cmd, "tz", profile.Timezone)
+	setFlagDefault(cmd, "output", profile.Output)
+	setFlagDefault(cmd, "upload", formatBool(profile.Upload))
+	setFlagDefault(cmd, "debug", formatBool(profile.Debug))
+	setFlagDefault(cmd, "k8s", formatBool(profile.Kubernetes.Enabled))
+
+	profilePlants := !plantEnv && !flagsChanged(cmd, "plant-id", "plant-name", "all-plants")
+
+	if profilePlants {
+		setFlagDefault(cmd, "plant-id", strings.Join(profile.Plants.IDs, ","))
+		setFlagDefault(cmd, "plant-name", strings.Join(profile.Plants.Names, ","))
+		if profile.Plants.All {
+			setFlagDefault(cmd, "all-plants", "true")
+		}
+	}
+
+	configAccounts = newConfigAccounts(profile, profilePlants)
+
+	return nil
+}
+
+// setFlagDefault sets the named flag of cmd to value unless the flag was
+// given, the command does not have it or value is empty.
+func setFlagDefault(cmd *cobra.Command, name, value string) {
+
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil || flag.Changed || value == "" {
+		return
+	}
+
+	flag.Value.Set(value)
+}
+
+func flagsChanged(cmd *cobra.Command, names ...string) bool {
+	for _, name := range names {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testConfig = `currentProfile: home
+profiles:
+  default:
+    endpoint: https://default.example.com
+    timezone: UTC
+  home:
+    endpoint: https://home.example.com
+    timezone: Europe/London
+    output: json
+    upload: true
+    account:
+      user: home-user
+    plants:
+      ids: ["1", "2"]
+  work:
+    endpoint: https://work.example.com
+    timezone: Africa/Johannesburg
+    accounts:
+    - name: acme
+      plants:
+        names: [Office]
+`
+
+// configEnv lists the variables the test profiles set, all of which are
+// unset while a test runs.
+var configEnv = []string{"SSCTL_CONFIG", "SSCTL_PROFILE", "SS_API_ENDPOINT", "SS_USER", "SS_PLANT_ID"}
+
+// unsetEnv unsets keys for the test, restoring them afterwards, so that
+// applyConfig sees them as not given and its own changes do not leak.
+func unsetEnv(t *testing.T, keys ...string) {
+
+	for _, key := range keys {
+		if old, ok := os.LookupEnv(key); ok {
+			t.Cleanup(func() { os.Setenv(key, old) })
+		} else {
+			t.Cleanup(func() { os.Unsetenv(key) })
+		}
+		os.Unsetenv(key)
+	}
+}
+
+// newConfigTestCommand returns a command with the flags applyConfig fills
+// in, with the defaults of the real commands.
+func newConfigTestCommand() *cobra.Command {
+
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("config", "", "")
+	cmd.Flags().String("profile", "", "")
+	cmd.Flags().String("tz", "", "")
+	cmd.Flags().StringP("output", "o", "", "")
+	cmd.Flags().Bool("upload", false, "")
+	cmd.Flags().Bool("debug", false, "")
+	cmd.Flags().Bool("k8s", false, "")
+	addPlantSelectorFlags(cmd.Flags())
+
+	return cmd
+}
+
+func TestApplyConfig(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+
+		wantEndpoint string
+		wantTz       string
+		wantOutput   string
+		wantUpload   bool
+		wantPlants   []string
+		wantAccounts []string
+	}{
+		{
+			name:         "current profile",
+			args:         []string{"--config", path},
+			wantEndpoint: "https://home.example.com",
+			wantTz:       "Europe/London",
+			wantOutput:   "json",
+			wantUpload:   true,
+			wantPlants:   []string{"1", "2"},
+		},
+		{
+			name:         "profile from the environment",
+			args:         []string{"--config", path},
+			env:          map[string]string{"SSCTL_PROFILE": "default"},
+			wantEndpoint: "https://default.example.com",
+			wantTz:       "UTC",
+		},
+		{
+			name:         "profile flag over the environment",
+			args:         []string{"--config", path, "--profile", "work"},
+			env:          map[string]string{"SSCTL_PROFILE": "default"},
+			wantEndpoint: "https://work.example.com",
+			wantTz:       "Africa/Johannesburg",
+			wantAccounts: []string{"acme"},
+		},
+		{
+			name:         "config from the environment",
+			env:          map[string]string{"SSCTL_CONFIG": path},
+			wantEndpoint: "https://home.example.com",
+			wantTz:       "Europe/London",
+			wantOutput:   "json",
+			wantUpload:   true,
+			wantPlants:   []string{"1", "2"},
+		},
+		{
+			name:         "environment over the profile",
+			args:         []string{"--config", path},
+			env:          map[string]string{"SS_API_ENDPOINT": "https://env.example.com", "SS_PLANT_ID": "9"},
+			wantEndpoint: "https://env.example.com",
+			wantTz:       "Europe/London",
+			wantOutput:   "json",
+			wantUpload:   true,
+		},
+		{
+			name:         "flags over the profile",
+			args:         []string{"--config", path, "--tz", "Asia/Tokyo", "-o", "csv", "--upload=false", "--plant-name", "Barn"},
+			wantEndpoint: "https://home.example.com",
+			wantTz:       "Asia/Tokyo",
+			wantOutput:   "csv",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			unsetEnv(t, configEnv...)
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+			}
+
+			saved := configAccounts
+			t.Cleanup(func() { configAccounts = saved })
+
+			cmd := newConfigTestCommand()
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(cmd); err != nil {
+				t.Fatal(err)
+			}
+
+			tz, _ := cmd.Flags().GetString("tz")
+			output, _ := cmd.Flags().GetString("output")
+			upload, _ := cmd.Flags().GetBool("upload")
+			plants, _ := cmd.Flags().GetStringSlice("plant-id")
+
+			if got := os.Getenv("SS_API_ENDPOINT"); got != tt.wantEndpoint {
+				t.Errorf("SS_API_ENDPOINT = %q, want %q", got, tt.wantEndpoint)
+			}
+			if tz != tt.wantTz {
+				t.Errorf("tz = %q, want %q", tz, tt.wantTz)
+			}
+			if output != tt.wantOutput {
+				t.Errorf("output = %q, want %q", output, tt.wantOutput)
+			}
+			if upload != tt.wantUpload {
+				t.Errorf("upload = %v, want %v", upload, tt.wantUpload)
+			}
+			if len(plants) != 0 || len(tt.wantPlants) != 0 {
+				if !reflect.DeepEqual(plants, tt.wantPlants) {
+					t.Errorf("plant-id = %v, want %v", plants, tt.wantPlants)
+				}
+			}
+
+			var names []string
+			for _, account := range configAccounts {
+				names = append(names, account.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantAccounts) {
+				t.Errorf("accounts = %v, want %v", names, tt.wantAccounts)
+			}
+		})
+	}
+}
+
+func TestApplyConfigDefaults(t *testing.T) {
+
+	unsetEnv(t, configEnv...)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	// Without a config file nothing changes.
+	cmd := newConfigTestCommand()
+	if err := applyConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	tz, _ := cmd.Flags().GetString("tz")
+	upload, _ := cmd.Flags().GetBool("upload")
+	if tz != "" || upload {
+		t.Errorf("tz = %q, upload = %v, want the flag defaults", tz, upload)
+	}
+	if _, ok := os.LookupEnv("SS_API_ENDPOINT"); ok {
+		t.Error("SS_API_ENDPOINT set without a config file")
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing config", []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}},
+		{"unknown profile", []string{"--config", path, "--profile", "garden"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			unsetEnv(t, configEnv...)
+
+			cmd := newConfigTestCommand()
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(cmd); err == nil {
+				t.Error("applyConfig did not fail")
+			}
+		})
+	}
+}
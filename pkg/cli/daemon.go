@@ -0,0 +1,354 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssctl/pkg/scheduler"
+	"ssctl/pkg/sunsynk"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// daemonCmd runs the auth, user, plant and inverter jobs in one process
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the auth, plant and inverter jobs on a schedule",
+	Long: `Run continuously, doing the work of the auth, user, plant and
+plant inverter commands on their own intervals in a single process.
+
+The token and the plant list are kept in memory: the token is checked every
+--auth-interval and refreshed before it expires, the plants and their
+inverters are listed every --user-interval. New alarms of the last day are
+reported every --alarm-interval, remembering the ones already reported in
+the --alarm-state file. Each wait is randomised by
+--jitter so the jobs do not all hit the API at once.
+
+Readings are written to InfluxDB with --upload, or to stdout. SIGINT and
+SIGTERM stop the schedule and wait for running jobs to finish.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("k8s")
+		uploadFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("upload")
+
+		var opts DaemonOptions
+		opts.AuthInterval, _ = cmd.Flags().GetDuration("auth-interval")
+		opts.UserInterval, _ = cmd.Flags().GetDuration("user-interval")
+		opts.PlantInterval, _ = cmd.Flags().GetDuration("plant-interval")
+		opts.InverterInterval, _ = cmd.Flags().GetDuration("inverter-interval")
+		opts.AlarmInterval, _ = cmd.Flags().GetDuration("alarm-interval")
+		opts.AlarmState, _ = cmd.Flags().GetString("alarm-state")
+		opts.Jitter, _ = cmd.Flags().GetFloat64("jitter")
+		opts.TZ, _ = cmd.Flags().GetString("tz")
+
+		if opts.AlarmState == "" {
+			path, err := defaultStatePath("alarms.json")
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.AlarmState = path
+		}
+
+		sink := func(ctx context.Context, data string) error {
+			fmt.Println(data)
+			return nil
+		}
+		if uploadFlagValue {
+			sink = NewInfluxWriter().Write
+		}
+
+		err := Daemon(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), opts, sink)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	addPlantSelectorFlags(daemonCmd.Flags())
+	daemonCmd.Flags().Duration("auth-interval", 5*time.Minute, "How often to check and refresh the token")
+	daemonCmd.Flags().Duration("user-interval", time.Hour, "How often to refresh the plant and inverter lists")
+	daemonCmd.Flags().Duration("plant-interval", 5*time.Minute, "How often to fetch the plant day chart")
+	daemonCmd.Flags().Duration("inverter-interval", time.Minute, "How often to fetch the inverter grid readings")
+	daemonCmd.Flags().Duration("alarm-interval", 5*time.Minute, "How often to report new inverter alarms")
+	daemonCmd.Flags().String("alarm-state", "", "File recording the alarms already reported (default: alarms.json under $XDG_STATE_HOME/ssctl)")
+	daemonCmd.Flags().Float64("jitter", 0.1, "Randomise each interval by +/- this fraction")
+	daemonCmd.Flags().String("tz", "", "IANA timezone of the plants, e.g. Europe/London (default: from the plant settings)")
+}
+
+// DaemonOptions controls the daemon schedule.
+type DaemonOptions struct {
+	AuthInterval     time.Duration
+	UserInterval     time.Duration
+	PlantInterval    time.Duration
+	InverterInterval time.Duration
+	AlarmInterval    time.Duration
+	AlarmState       string
+	Jitter           float64
+	TZ               string
+}
+
+type daemon struct {
+	accounts []*daemonAccount
+	sink     func(context.Context, string) error
+
+	alarms     *alarmState
+	alarmState string
+}
+
+// daemonAccount holds the token and plants of one account.
+type daemonAccount struct {
+	account Account
+	client  *sunsynk.Client
+	tokens  *sunsynk.RefreshingTokenSource
+	plants  *plantCache
+}
+
+// Daemon runs the jobs until ctx is cancelled. Failed runs are logged and
+// retried on the next tick.
+func Daemon(ctx context.Context, k8s bool, sel PlantSelector, opts DaemonOptions, sink func(context.Context, string) error) error {
+
+	for _, interval := range []time.Duration{opts.AuthInterval, opts.UserInterval, opts.PlantInterval, opts.InverterInterval, opts.AlarmInterval} {
+		if interval <= 0 {
+			return fmt.Errorf("intervals must be positive")
+		}
+	}
+
+	alarms, err := loadAlarmState(opts.AlarmState)
+	if err != nil {
+		return err
+	}
+
+	d := &daemon{
+		sink: sink,
+
+		alarms:     alarms,
+		alarmState: opts.AlarmState,
+	}
+
+	for _, account := range accounts {
+
+		client := NewClient(nil)
+		tokens := NewTokenSource(client, account, k8s)
+		client.Tokens = tokens
+
+		d.accounts = append(d.accounts, &daemonAccount{
+			account: account,
+			client:  client,
+			tokens:  tokens,
+			plants:  &plantCache{client: client, sel: account.selector(sel), tz: opts.TZ},
+		})
+	}
+
+	// Log in and list the plants before the first plant and inverter runs,
+	// giving up straight away if that is impossible.
+	if err := d.auth(ctx); err != nil {
+		return err
+	}
+	if err := d.user(ctx); err != nil && d.plantCount() == 0 {
+		return err
+	}
+
+	sched := &scheduler.Scheduler{}
+	sched.Add(scheduler.Task{Name: "auth", Interval: opts.AuthInterval, Jitter: opts.Jitter, Delay: opts.AuthInterval, Run: d.auth})
+	sched.Add(scheduler.Task{Name: "user", Interval: opts.UserInterval, Jitter: opts.Jitter, Delay: opts.UserInterval, Run: d.user})
+	sched.Add(scheduler.Task{Name: "plant", Interval: opts.PlantInterval, Jitter: opts.Jitter, Run: d.plant})
+	sched.Add(scheduler.Task{Name: "inverter", Interval: opts.InverterInterval, Jitter: opts.Jitter, Run: d.inverter})
+	sched.Add(scheduler.Task{Name: "alarm", Interval: opts.AlarmInterval, Jitter: opts.Jitter, Run: d.alarm})
+
+	log.Infof("Daemon started with %d plants of %d accounts", d.plantCount(), len(d.accounts))
+
+	sched.Run(ctx)
+
+	log.Info("Daemon stopped")
+
+	return nil
+}
+
+func (d *daemon) plantCount() int {
+
+	count := 0
+	for _, a := range d.accounts {
+		count += len(a.plants.Plants())
+	}
+
+	return count
+}
+
+// auth makes sure the in-memory token of every account is valid,
+// refreshing and storing it when it is close to expiry.
+func (d *daemon) auth(ctx context.Context) error {
+
+	var errs []error
+
+	for _, a := range d.accounts {
+
+		token, err := a.tokens.AuthToken(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", a.account, err))
+			continue
+		}
+
+		if expiry, ok := token.ExpiresAt(); ok {
+			log.Debugf("Token of account %s valid until %s", a.account, expiry.Format(time.RFC3339))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d *daemon) user(ctx context.Context) error {
+
+	var errs []error
+
+	for _, a := range d.accounts {
+
+		changes, err := a.plants.Refresh(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", a.account, err))
+		}
+
+		for _, id := range changes.plants {
+			log.Infof("Plant %d is no longer selected", id)
+		}
+		for _, sn := range changes.inverters {
+			log.Infof("Inverter %s has been removed", sn)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// plant writes today's chart of every plant.
+func (d *daemon) plant(ctx context.Context) error {
+
+	var errs []error
+	var records []Record
+
+	for _, a := range d.accounts {
+		for _, p := range a.plants.Plants() {
+
+			today := time.Now().In(p.loc).Format("2006-01-02")
+
+			plantdata, err := a.client.GetPlantData(ctx, today, strconv.Itoa(p.plant.Id))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			output, err := Plant2Records(today, p.plant.Id, p.plant.Name, p.loc, plantdata)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			records = append(records, a.account.label(output)...)
+		}
+	}
+
+	errs = append(errs, d.write(ctx, records))
+
+	return errors.Join(errs...)
+}
+
+// inverter writes the grid readings of every inverter.
+func (d *daemon) inverter(ctx context.Context) error {
+
+	var errs []error
+	var records []Record
+
+	for _, a := range d.accounts {
+		for _, p := range a.plants.Plants() {
+			for _, sn := range p.inverters {
+
+				gridRealtimeData, err := a.client.GetInverterGridRealtimeData(ctx, sn)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+
+				output, err := InverterGridRealtime2Records(strconv.Itoa(p.plant.Id), p.plant.Name, sn, gridRealtimeData)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+
+				records = append(records, a.account.label(output)...)
+			}
+		}
+	}
+
+	errs = append(errs, d.write(ctx, records))
+
+	return errors.Join(errs...)
+}
+
+// write sends records to the sink as line protocol.
+func (d *daemon) write(ctx context.Context, records []Record) error {
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	lines, err := EncodeRecords(records)
+	if err != nil {
+		return err
+	}
+
+	return d.sink(ctx, strings.Join(lines, "\n"))
+}
+
+// alarm reports the alarms of the last day that have not been reported yet.
+func (d *daemon) alarm(ctx context.Context) error {
+
+	var errs []error
+	var alarms []PlantAlarm
+
+	since := time.Now().Add(-24 * time.Hour)
+
+	for _, a := range d.accounts {
+		for _, p := range a.plants.Plants() {
+
+			found, err := plantAlarms(ctx, a.client, a.account, p.plant, p.loc, since, nil)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			alarms = append(alarms, d.alarms.fresh(found)...)
+		}
+	}
+
+	if len(alarms) == 0 {
+		return errors.Join(errs...)
+	}
+
+	lines, err := Alarms2Line(alarms)
+	if err == nil {
+		err = d.sink(ctx, strings.Join(lines, "\n"))
+	}
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	d.alarms.mark(alarms)
+	d.alarms.prune(time.Now().Add(-alarmStateRetention))
+	errs = append(errs, d.alarms.save(d.alarmState))
+
+	log.Infof("Reported %d new alarms", len(alarms))
+
+	return errors.Join(errs...)
+}
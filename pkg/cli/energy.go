@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// energyCmd gets the energy aggregates of each plant
+var energyCmd = &cobra.Command{
+	Use:   "energy",
+	Short: "Get the monthly, yearly or lifetime energy of each plant",
+	Long: `Get the energy of each selected plant aggregated by the Sunsynk API:
+PV generation, consumption, grid import and export and battery charge and
+discharge.
+
+--period month gives a point per day of the month in --date (2006-01),
+--period year a point per month of the year in --date (2006) and
+--period total a point per year since the plant was built. Each point is
+timestamped at the start of its day, month or year in the plant's timezone.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Root().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Root().PersistentFlags().GetBool("k8s")
+		uploadFlagValue, _ := cmd.Root().PersistentFlags().GetBool("upload")
+		tzFlagValue, _ := cmd.Flags().GetString("tz")
+		periodFlagValue, _ := cmd.Flags().GetString("period")
+		dateFlagValue, _ := cmd.Flags().GetString("date")
+		format := outputFormatFromFlags(cmd, OutputLine)
+
+		period := sunsynk.EnergyPeriod(periodFlagValue)
+		if !period.Valid() {
+			log.Fatalf("Unknown period %q, expected month, year or total", periodFlagValue)
+		}
+
+		edata := Energy(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), tzFlagValue, period, dateFlagValue)
+
+		if uploadFlagValue {
+			UploadRecords(cmd.Context(), edata)
+		} else {
+			PrintRecords(format, edata)
+		}
+	},
+}
+
+func init() {
+	plantCmd.AddCommand(energyCmd)
+	energyCmd.Flags().String("period", string(sunsynk.EnergyMonth), "Period: month, year or total")
+	energyCmd.Flags().String("date", "", "Month (2006-01) or year (2006) to get (default: the current one)")
+}
+
+// energyLayouts are the date layouts of each period, which are also the
+// layouts of the record times of the period below it.
+var energyLayouts = map[sunsynk.EnergyPeriod]struct{ date, record string }{
+	sunsynk.EnergyMonth: {"2006-01", "2006-01-02"},
+	sunsynk.EnergyYear:  {"2006", "2006-01"},
+	sunsynk.EnergyTotal: {"", "2006"},
+}
+
+// Energy returns the energy of every selected plant over the period
+// containing date, or the current period when date is empty.
+func Energy(ctx context.Context, k8s bool, sel PlantSelector, tz string, period sunsynk.EnergyPeriod, date string) []Record {
+
+	var energyRecords []Record
+
+	layouts := energyLayouts[period]
+
+	if date != "" && period != sunsynk.EnergyTotal {
+		if _, err := time.Parse(layouts.date, date); err != nil {
+			log.Fatalf("Invalid --date %q for the %s period, see --help", date, period)
+		}
+	}
+
+	for _, account := range accounts {
+
+		client := NewAuthenticatedClient(account, k8s)
+
+		for _, plant := range GetPlants(ctx, client, account, k8s, sel) {
+
+			loc := PlantLocation(ctx, client, plant.Id, tz)
+
+			current := date
+			if current == "" && period != sunsynk.EnergyTotal {
+				current = time.Now().In(loc).Format(layouts.date)
+			}
+
+			energy, err := client.GetPlantEnergy(ctx, period, current, strconv.Itoa(plant.Id))
+			if err != nil {
+				FatalAPIError(err)
+			}
+
+			output, err := Energy2Records(period, plant.Id, plant.Name, loc, energy)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			energyRecords = append(energyRecords, account.label(output)...)
+		}
+	}
+
+	return energyRecords
+}
+
+// Energy2Records converts an energy chart of a plant into
+// sunsynk_plant_energy records tagged with the period. Each record is
+// timestamped at the start of its day, month or year in loc.
+func Energy2Records(period sunsynk.EnergyPeriod, plantID int, plantName string, loc *time.Location, energy sunsynk.SSApiPlantDataResponse) ([]Record, error) {
+
+	var rows []LineFormat
+
+	layout := energyLayouts[period].record
+
+	for _, types := range energy.Data.Infos {
+		for _, datum := range types.Records {
+
+			value, err := strconv.ParseFloat(datum.Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("plant %d %s at %s: %w", plantID, types.Label, datum.Time, err)
+			}
+
+			start, err := time.ParseInLocation(layout, datum.Time, loc)
+			if err != nil {
+				return nil, fmt.Errorf("plant %d %s: invalid %s record time %q", plantID, types.Label, period, datum.Time)
+			}
+
+			rows = append(rows, LineFormat{
+				Name:      types.Label,
+				Value:     value,
+				Unit:      types.Unit,
+				PlantId:   plantID,
+				PlantName: plantName,
+				Timestamp: start.Unix(),
+				Tags:      map[string]string{"period": string(period)},
+			})
+		}
+	}
+
+	// sunsynk_plant_energy,period=month,plant=123456 export=3.2,pv=21.4 1682895600
+
+	return NewRecords("sunsynk_plant_energy", rows), nil
+}
@@ -0,0 +1,517 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssctl/pkg/metrics"
+	"ssctl/pkg/scheduler"
+	"ssctl/pkg/sunsynk"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// exporterCmd serves plant and inverter metrics for Prometheus
+var exporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Serve plant and inverter metrics for Prometheus",
+	Long: `Run continuously, polling the Sunsynk API and serving the latest readings
+in the Prometheus text format on /metrics.
+
+The plant list and inverters are refreshed every --user-interval, the plant
+day chart every --plant-interval and the inverter realtime readings every
+--inverter-interval.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("k8s")
+
+		var opts ExporterOptions
+		opts.Listen, _ = cmd.Flags().GetString("listen")
+		opts.UserInterval, _ = cmd.Flags().GetDuration("user-interval")
+		opts.PlantInterval, _ = cmd.Flags().GetDuration("plant-interval")
+		opts.InverterInterval, _ = cmd.Flags().GetDuration("inverter-interval")
+		opts.TZ, _ = cmd.Flags().GetString("tz")
+
+		err := Exporter(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exporterCmd)
+	addPlantSelectorFlags(exporterCmd.Flags())
+	exporterCmd.Flags().String("listen", ":9105", "Address to serve /metrics on")
+	exporterCmd.Flags().Duration("user-interval", time.Hour, "How often to refresh the plant and inverter lists")
+	exporterCmd.Flags().Duration("plant-interval", 5*time.Minute, "How often to poll the plant day chart")
+	exporterCmd.Flags().Duration("inverter-interval", time.Minute, "How often to poll the inverter realtime readings")
+	exporterCmd.Flags().String("tz", "", "IANA timezone of the plants, e.g. Europe/London (default: from the plant settings)")
+}
+
+// ExporterOptions controls the exporter.
+type ExporterOptions struct {
+	Listen           string
+	UserInterval     time.Duration
+	PlantInterval    time.Duration
+	InverterInterval time.Duration
+	TZ               string
+}
+
+type exporter struct {
+	accounts []exporterAccount
+
+	registry *metrics.Registry
+
+	pollDuration    *metrics.Vec
+	pollLastSuccess *metrics.Vec
+	polls           *metrics.Vec
+	apiErrors       *metrics.Vec
+
+	plantInfo  *metrics.Vec
+	plantChart *metrics.Vec
+
+	inverterInfo       *metrics.Vec
+	inverterStatus     *metrics.Vec
+	inverterRatedPower *metrics.Vec
+	gatewayStatus      *metrics.Vec
+
+	gridImportToday *metrics.Vec
+	gridExportToday *metrics.Vec
+	gridImportTotal *metrics.Vec
+	gridExportTotal *metrics.Vec
+	gridPac         *metrics.Vec
+	gridFac         *metrics.Vec
+	gridPf          *metrics.Vec
+	gridPhaseVolts  *metrics.Vec
+	gridPhaseAmps   *metrics.Vec
+	gridPhaseWatts  *metrics.Vec
+
+	pvPac     *metrics.Vec
+	pvToday   *metrics.Vec
+	pvTotal   *metrics.Vec
+	mpptVolts *metrics.Vec
+	mpptAmps  *metrics.Vec
+	mpptWatts *metrics.Vec
+	mpptToday *metrics.Vec
+}
+
+// exporterAccount is the client and plants of one account.
+type exporterAccount struct {
+	account Account
+	client  *sunsynk.Client
+	plants  *plantCache
+}
+
+func newExporter(k8s bool, sel PlantSelector, tz string) *exporter {
+
+	r := metrics.NewRegistry()
+
+	var list []exporterAccount
+	for _, account := range accounts {
+		client := NewAuthenticatedClient(account, k8s)
+		list = append(list, exporterAccount{
+			account: account,
+			client:  client,
+			plants:  &plantCache{client: client, sel: account.selector(sel), tz: tz},
+		})
+	}
+
+	return &exporter{
+		accounts: list,
+		registry: r,
+
+		pollDuration:    r.Gauge("ssctl_poll_duration_seconds", "Duration of the last poll of the Sunsynk API."),
+		pollLastSuccess: r.Gauge("ssctl_poll_last_success_timestamp_seconds", "Unix time of the last poll without errors."),
+		polls:           r.Counter("ssctl_polls_total", "Number of polls of the Sunsynk API."),
+		apiErrors:       r.Counter("ssctl_api_errors_total", "Number of failed Sunsynk API calls, by HTTP status."),
+
+		plantInfo:  r.Gauge("sunsynk_plant_info", "Selected plants, always 1."),
+		plantChart: r.Gauge("sunsynk_plant_chart_value", "Latest value of each series of the plant day chart."),
+
+		inverterInfo:       r.Gauge("sunsynk_inverter_info", "Model and firmware versions of each inverter, always 1."),
+		inverterStatus:     r.Gauge("sunsynk_inverter_status", "Status code of each inverter as reported by the API."),
+		inverterRatedPower: r.Gauge("sunsynk_inverter_rated_power", "Rated power of each inverter in W."),
+		gatewayStatus:      r.Gauge("sunsynk_gateway_status", "Status code of the datalogger of each inverter as reported by the API."),
+
+		gridImportToday: r.Gauge("sunsynk_inverter_grid_import_today", "Energy imported from the grid today in kWh."),
+		gridExportToday: r.Gauge("sunsynk_inverter_grid_export_today", "Energy exported to the grid today in kWh."),
+		gridImportTotal: r.Counter("sunsynk_inverter_grid_import_total", "Energy imported from the grid in kWh."),
+		gridExportTotal: r.Counter("sunsynk_inverter_grid_export_total", "Energy exported to the grid in kWh."),
+		gridPac:         r.Gauge("sunsynk_inverter_grid_pac", "Active power at the grid meter in W, negative when exporting."),
+		gridFac:         r.Gauge("sunsynk_inverter_grid_fac", "Grid frequency in Hz."),
+		gridPf:          r.Gauge("sunsynk_inverter_grid_pf", "Grid power factor."),
+		gridPhaseVolts:  r.Gauge("sunsynk_inverter_grid_volt", "Grid voltage per phase in V."),
+		gridPhaseAmps:   r.Gauge("sunsynk_inverter_grid_current", "Grid current per phase in A."),
+		gridPhaseWatts:  r.Gauge("sunsynk_inverter_grid_power", "Grid power per phase in W."),
+
+		pvPac:     r.Gauge("sunsynk_inverter_pv_pac", "PV power in W."),
+		pvToday:   r.Gauge("sunsynk_inverter_pv_today", "PV energy generated today in kWh."),
+		pvTotal:   r.Counter("sunsynk_inverter_pv_total", "PV energy generated in kWh."),
+		mpptVolts: r.Gauge("sunsynk_inverter_mppt_volt", "PV voltage per MPPT in V."),
+		mpptAmps:  r.Gauge("sunsynk_inverter_mppt_current", "PV current per MPPT in A."),
+		mpptWatts: r.Gauge("sunsynk_inverter_mppt_power", "PV power per MPPT in W."),
+		mpptToday: r.Gauge("sunsynk_inverter_mppt_today", "PV energy per MPPT today in kWh."),
+	}
+}
+
+// Exporter polls the API on the configured intervals and serves the
+// readings on opts.Listen until ctx is cancelled.
+func Exporter(ctx context.Context, k8s bool, sel PlantSelector, opts ExporterOptions) error {
+
+	for _, interval := range []time.Duration{opts.UserInterval, opts.PlantInterval, opts.InverterInterval} {
+		if interval <= 0 {
+			return fmt.Errorf("poll intervals must be positive")
+		}
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	e := newExporter(k8s, sel, opts.TZ)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e.registry.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, `ssctl exporter, metrics are on <a href="/metrics">/metrics</a>`)
+	})
+
+	server := &http.Server{
+		Addr:              opts.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Infof("Serving metrics on %s/metrics", opts.Listen)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	// The plant list is needed by the other pollers, so fetch it first.
+	start := time.Now()
+	userErr := e.pollUser(ctx)
+	e.recordPoll("user", time.Since(start), userErr)
+	if userErr != nil {
+		log.Warnf("Task user failed: %v", userErr)
+	}
+
+	sched := &scheduler.Scheduler{OnRun: e.recordPoll}
+	sched.Add(scheduler.Task{Name: "user", Interval: opts.UserInterval, Delay: opts.UserInterval, Run: e.pollUser})
+	sched.Add(scheduler.Task{Name: "plant", Interval: opts.PlantInterval, Run: e.pollPlants})
+	sched.Add(scheduler.Task{Name: "inverter", Interval: opts.InverterInterval, Run: e.pollInverters})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sched.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+
+	<-done
+
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	return err
+}
+
+// recordPoll records the duration and outcome of a poll.
+func (e *exporter) recordPoll(name string, duration time.Duration, err error) {
+
+	labels := metrics.Labels{"poller": name}
+
+	e.pollDuration.Set(labels, duration.Seconds())
+	e.polls.Inc(labels)
+
+	if err == nil {
+		e.pollLastSuccess.Set(labels, float64(time.Now().Unix()))
+	}
+}
+
+// apiError counts a failed API call of account, or each of the calls
+// joined in err, and passes err through.
+func (e *exporter) apiError(account Account, poller string, err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			e.apiError(account, poller, err)
+		}
+		return err
+	}
+
+	status := "error"
+
+	var apiErr *sunsynk.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode != 0 {
+		status = strconv.Itoa(apiErr.StatusCode)
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		status = "timeout"
+	}
+
+	e.apiErrors.Inc(account.labels(metrics.Labels{"poller": poller, "status": status}))
+
+	return err
+}
+
+// pollUser refreshes the selected plants of every account and their
+// inverters, dropping the series of any plant or inverter that has gone.
+func (e *exporter) pollUser(ctx context.Context) error {
+
+	var errs []error
+
+	for _, a := range e.accounts {
+
+		changes, err := a.plants.Refresh(ctx)
+		e.apiError(a.account, "user", err)
+
+		for _, id := range changes.plants {
+			e.deleteSeries(metrics.Labels{"plant": strconv.Itoa(id)})
+		}
+		for _, sn := range changes.inverters {
+			e.deleteSeries(metrics.Labels{"inverter": sn})
+		}
+
+		plants := a.plants.Plants()
+		if len(plants) > 0 || err == nil {
+			e.plantInfo.DeleteMatching(a.account.labels(metrics.Labels{}))
+		}
+		for _, p := range plants {
+			e.plantInfo.Set(a.account.labels(metrics.Labels{
+				"plant":      strconv.Itoa(p.plant.Id),
+				"plant_name": p.plant.Name,
+				"timezone":   p.loc.String(),
+			}), 1)
+
+			for _, inverter := range p.devices {
+				e.recordInventory(NewInventoryDevice(a.account, p.plant, inverter))
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", a.account, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// recordInventory records the model, firmware and status of an inverter.
+// The info series of the previous firmware is dropped so that only the
+// current versions are exported.
+func (e *exporter) recordInventory(d InventoryDevice) {
+
+	labels := metrics.Labels{
+		"plant":      strconv.Itoa(d.PlantId),
+		"plant_name": d.PlantName,
+		"inverter":   d.Sn,
+	}
+	if d.Account != "" {
+		labels["account"] = d.Account
+	}
+
+	e.inverterInfo.DeleteMatching(metrics.Labels{"inverter": d.Sn})
+	e.inverterInfo.Set(withLabels(labels, metrics.Labels{
+		"model":      d.Model,
+		"comm_type":  d.CommType,
+		"master_ver": d.MasterVer,
+		"soft_ver":   d.SoftVer,
+		"hard_ver":   d.HardVer,
+		"hmi_ver":    d.HmiVer,
+		"bms_ver":    d.BmsVer,
+	}), 1)
+
+	e.inverterStatus.Set(labels, float64(d.Status))
+	e.inverterRatedPower.Set(labels, float64(d.RatedPower))
+
+	e.gatewayStatus.DeleteMatching(metrics.Labels{"inverter": d.Sn})
+	e.gatewayStatus.Set(withLabel(labels, "gateway", d.GatewaySn), float64(d.GatewayStatus))
+}
+
+// pollPlants records the latest value of every series of today's chart of
+// every plant.
+func (e *exporter) pollPlants(ctx context.Context) error {
+
+	var errs []error
+
+	for _, a := range e.accounts {
+		for _, p := range a.plants.Plants() {
+
+			today := time.Now().In(p.loc).Format("2006-01-02")
+
+			plantdata, err := a.client.GetPlantData(ctx, today, strconv.Itoa(p.plant.Id))
+			if err != nil {
+				errs = append(errs, e.apiError(a.account, "plant", err))
+				continue
+			}
+
+			for _, info := range plantdata.Data.Infos {
+				if len(info.Records) == 0 {
+					continue
+				}
+
+				value, err := strconv.ParseFloat(info.Records[len(info.Records)-1].Value, 64)
+				if err != nil {
+					continue
+				}
+
+				e.plantChart.Set(a.account.labels(metrics.Labels{
+					"plant":      strconv.Itoa(p.plant.Id),
+					"plant_name": p.plant.Name,
+					"series":     strings.ToLower(info.Label),
+					"unit":       info.Unit,
+				}), value)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// pollInverters records the grid and PV realtime readings of every inverter.
+func (e *exporter) pollInverters(ctx context.Context) error {
+
+	var errs []error
+
+	for _, a := range e.accounts {
+		for _, p := range a.plants.Plants() {
+			for _, sn := range p.inverters {
+
+				labels := a.account.labels(metrics.Labels{
+					"plant":      strconv.Itoa(p.plant.Id),
+					"plant_name": p.plant.Name,
+					"inverter":   sn,
+				})
+
+				grid, err := a.client.GetInverterGridRealtimeData(ctx, sn)
+				if err != nil {
+					errs = append(errs, e.apiError(a.account, "inverter", err))
+				} else {
+					e.recordGrid(labels, grid.Data)
+				}
+
+				input, err := a.client.GetInverterInputRealtimeData(ctx, sn)
+				if err != nil {
+					errs = append(errs, e.apiError(a.account, "inverter", err))
+				} else {
+					e.recordPV(labels, input.Data)
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (e *exporter) recordGrid(labels metrics.Labels, data sunsynk.SSApiInverterGridRealtimeData) {
+
+	setParsed(e.gridImportToday, labels, data.ETodayFrom)
+	setParsed(e.gridExportToday, labels, data.ETodayTo)
+	setParsed(e.gridImportTotal, labels, data.ETotalFrom)
+	setParsed(e.gridExportTotal, labels, data.ETotalTo)
+
+	e.gridPac.Set(labels, float64(data.Pac))
+	e.gridFac.Set(labels, data.Fac)
+	e.gridPf.Set(labels, data.Pf)
+
+	for i, phase := range data.Vip {
+		phaseLabels := withLabel(labels, "phase", strconv.Itoa(i+1))
+		setParsed(e.gridPhaseVolts, phaseLabels, phase.Volt)
+		setParsed(e.gridPhaseAmps, phaseLabels, phase.Current)
+		e.gridPhaseWatts.Set(phaseLabels, float64(phase.Power))
+	}
+}
+
+func (e *exporter) recordPV(labels metrics.Labels, data sunsynk.SSApiInverterInputRealtimeData) {
+
+	e.pvPac.Set(labels, float64(data.Pac))
+	e.pvToday.Set(labels, data.Etoday)
+	e.pvTotal.Set(labels, data.Etotal)
+
+	for _, pv := range data.PvIV {
+		mpptLabels := withLabel(labels, "mppt", strconv.Itoa(pv.PvNo))
+		e.mpptVolts.Set(mpptLabels, float64(pv.Vpv))
+		e.mpptAmps.Set(mpptLabels, float64(pv.Ipv))
+		e.mpptWatts.Set(mpptLabels, float64(pv.Ppv))
+		e.mpptToday.Set(mpptLabels, float64(pv.TodayPv))
+	}
+}
+
+// deleteSeries drops every plant and inverter series matching labels.
+func (e *exporter) deleteSeries(labels metrics.Labels) {
+
+	for _, v := range []*metrics.Vec{
+		e.plantChart,
+		e.inverterInfo, e.inverterStatus, e.inverterRatedPower, e.gatewayStatus,
+		e.gridImportToday, e.gridExportToday, e.gridImportTotal, e.gridExportTotal,
+		e.gridPac, e.gridFac, e.gridPf, e.gridPhaseVolts, e.gridPhaseAmps, e.gridPhaseWatts,
+		e.pvPac, e.pvToday, e.pvTotal, e.mpptVolts, e.mpptAmps, e.mpptWatts, e.mpptToday,
+	} {
+		v.DeleteMatching(labels)
+	}
+}
+
+// setParsed sets v from a numeric string, leaving it unchanged when the API
+// returned something that is not a number.
+func setParsed(v *metrics.Vec, labels metrics.Labels, value string) {
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+
+	v.Set(labels, f)
+}
+
+func withLabel(labels metrics.Labels, name, value string) metrics.Labels {
+	return withLabels(labels, metrics.Labels{name: value})
+}
+
+// withLabels returns a copy of labels with extra added.
+func withLabels(labels, extra metrics.Labels) metrics.Labels {
+
+	copied := make(metrics.Labels, len(labels)+len(extra))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	for k, v := range extra {
+		copied[k] = v
+	}
+
+	return copied
+}
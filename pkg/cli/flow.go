@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+
+	"github.com/spf13/cobra"
+)
+
+// flowCmd shows the current power flow of each plant
+var flowCmd = &cobra.Command{
+	Use:   "flow",
+	Short: "Get the current power flow between PV, battery, grid and load",
+	Long: `Get the power flow diagram of each selected plant as shown by the Sunsynk
+web UI: the power of the PV, battery, grid, load and generator and the
+direction each one is flowing in.
+
+The flows are printed in the --output format: as a diagram-like table for
+--output table, with the flow and its direction flags as the API names them
+for json, ndjson and yaml, and as one row per plant for csv. With --upload
+they are written to InfluxDB as line protocol.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Parent().Parent().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Parent().Parent().PersistentFlags().GetBool("k8s")
+		uploadFlagValue, _ := cmd.Parent().Parent().PersistentFlags().GetBool("upload")
+		tzFlagValue, _ := cmd.Flags().GetString("tz")
+		format := outputFormatFromFlags(cmd, OutputLine)
+
+		flows := Flow(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), tzFlagValue)
+
+		switch {
+		case uploadFlagValue:
+			UploadRecords(cmd.Context(), Flow2Records(flows))
+		case format == OutputTable:
+			FlowTable(flows)
+		default:
+			printOutput(format, flows, flowTable)
+		}
+	},
+}
+
+func init() {
+	plantCmd.AddCommand(flowCmd)
+}
+
+// PlantFlow is the power flow of a plant at a point in time.
+type PlantFlow struct {
+	Account   string                     `json:"account,omitempty"`
+	PlantId   int                        `json:"plant_id"`
+	PlantName string                     `json:"plant_name,omitempty"`
+	Time      time.Time                  `json:"time"`
+	Flow      sunsynk.SSApiPlantFlowData `json:"flow"`
+}
+
+// Flow returns the current power flow of every selected plant.
+func Flow(ctx context.Context, k8s bool, sel PlantSelector, tz string) []PlantFlow {
+
+	var flows []PlantFlow
+
+	for _, account := range accounts {
+
+		client := NewAuthenticatedClient(account, k8s)
+
+		for _, plant := range GetPlants(ctx, client, account, k8s, sel) {
+
+			now := time.Now().Truncate(time.Second).In(PlantLocation(ctx, client, plant.Id, tz))
+
+			flow, err := client.GetPlantFlow(ctx, now.Format("2006-01-02"), strconv.Itoa(plant.Id))
+			if err != nil {
+				FatalAPIError(err)
+			}
+
+			flows = append(flows, PlantFlow{
+				Account:   account.Name,
+				PlantId:   plant.Id,
+				PlantName: plant.Name,
+				Time:      now,
+				Flow:      flow.Data,
+			})
+		}
+	}
+
+	return flows
+}
+
+// Flow2Records converts plant flows into sunsynk_plant_flow records.
+// Directions are written as 0 or 1 next to the powers.
+func Flow2Records(flows []PlantFlow) []Record {
+
+	var rows []LineFormat
+
+	for _, f := range flows {
+
+		row := LineFormat{Account: f.Account, PlantId: f.PlantId, PlantName: f.PlantName, Timestamp: f.Time.Unix()}
+
+		rows = append(rows,
+			row.With("pv_power", float64(f.Flow.PvPower)),
+			row.With("battery_power", float64(f.Flow.BattPower)),
+			row.With("grid_power", float64(f.Flow.GridOrMeterPower)),
+			row.With("load_power", float64(f.Flow.LoadOrEpsPower)),
+			row.With("gen_power", float64(f.Flow.GenPower)),
+			row.With("smart_load_power", float64(f.Flow.SmartLoadPower)),
+			row.With("ups_load_power", float64(f.Flow.UpsLoadPower)),
+			row.With("home_load_power", float64(f.Flow.HomeLoadPower)),
+			row.With("soc", float64(f.Flow.Soc)),
+			row.With("pv_to", boolField(f.Flow.PvTo)),
+			row.With("to_load", boolField(f.Flow.ToLoad)),
+			row.With("to_grid", boolField(f.Flow.ToGrid)),
+			row.With("grid_to", boolField(f.Flow.GridTo)),
+			row.With("to_battery", boolField(f.Flow.ToBat)),
+			row.With("battery_to", boolField(f.Flow.BatTo)),
+			row.With("gen_to", boolField(f.Flow.GenTo)),
+		)
+	}
+
+	return NewRecords("sunsynk_plant_flow", rows)
+}
+
+// flowTable lays plant flows out for the csv and line outputs, one row per
+// plant.
+var flowTable = outputTable[PlantFlow]{
+	columns: []string{
+		"time", "plant_id", "plant_name",
+		"pv_power", "battery_power", "grid_power", "load_power", "gen_power", "soc",
+		"pv_to", "to_load", "to_grid", "grid_to", "to_battery", "battery_to", "gen_to",
+	},
+	row: func(f PlantFlow) []string {
+		power := func(v sunsynk.Float) string { return strconv.FormatFloat(float64(v), 'f', -1, 64) }
+		return []string{
+			f.Time.Format(time.RFC3339), strconv.Itoa(f.PlantId), f.PlantName,
+			power(f.Flow.PvPower), power(f.Flow.BattPower), power(f.Flow.GridOrMeterPower),
+			power(f.Flow.LoadOrEpsPower), power(f.Flow.GenPower), power(f.Flow.Soc),
+			strconv.FormatBool(f.Flow.PvTo), strconv.FormatBool(f.Flow.ToLoad), strconv.FormatBool(f.Flow.ToGrid),
+			strconv.FormatBool(f.Flow.GridTo), strconv.FormatBool(f.Flow.ToBat), strconv.FormatBool(f.Flow.BatTo),
+			strconv.FormatBool(f.Flow.GenTo),
+		}
+	},
+	account: func(f PlantFlow) string { return f.Account },
+	lines: func(flows []PlantFlow) ([]string, error) {
+		return EncodeRecords(Flow2Records(flows))
+	},
+}
+
+// FlowTable prints plant flows as a table for people.
+func FlowTable(flows []PlantFlow) {
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for i, f := range flows {
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		title := "Plant " + strconv.Itoa(f.PlantId)
+		if f.PlantName != "" {
+			title += " (" + f.PlantName + ")"
+		}
+		if f.Account != "" {
+			title += " of account " + f.Account
+		}
+		fmt.Fprintf(w, "%s at %s\n", title, f.Time.Format("2006-01-02 15:04:05 MST"))
+		fmt.Fprintln(w, "FLOW\tPOWER\tDIRECTION")
+
+		fmt.Fprintf(w, "PV\t%.0f W\t%s\n", f.Flow.PvPower, direction(f.Flow.PvTo, "producing", false, ""))
+		fmt.Fprintf(w, "Battery\t%.0f W\t%s (SOC %.0f%%)\n", f.Flow.BattPower, direction(f.Flow.ToBat, "charging", f.Flow.BatTo, "discharging"), f.Flow.Soc)
+		fmt.Fprintf(w, "Grid\t%.0f W\t%s\n", f.Flow.GridOrMeterPower, direction(f.Flow.GridTo, "importing", f.Flow.ToGrid, "exporting"))
+		fmt.Fprintf(w, "Load\t%.0f W\t%s\n", f.Flow.LoadOrEpsPower, direction(f.Flow.ToLoad, "consuming", false, ""))
+		if f.Flow.ExistsGen {
+			fmt.Fprintf(w, "Generator\t%.0f W\t%s\n", f.Flow.GenPower, direction(f.Flow.GenTo, "running", false, ""))
+		}
+	}
+
+	w.Flush()
+}
+
+func direction(a bool, aName string, b bool, bName string) string {
+
+	switch {
+	case a:
+		return aName
+	case b:
+		return bName
+	}
+
+	return "idle"
+}
+
+// boolField returns b as the 0 or 1 written to InfluxDB.
+func boolField(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -1,11 +1,15 @@
 package cli
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"ssctl/pkg/kube"
+	"context"
+	"ssctl/pkg/influxdb"
+	"ssctl/pkg/lineprotocol"
 	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/utils"
+	"ssctl/pkg/vault"
+	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -15,114 +19,200 @@ type LineFormat struct {
 	Name      string
 	Unit      string
 	PlantId   int
+	PlantName string
+	Inverter  string
+	Account   string
 	Timestamp int64
+	// Tags are added to the plant and inverter tags, e.g. the MPPT or phase.
+	Tags map[string]string
 }
 
-func GetToken(k8s bool) string {
-
-	var SunsynkToken string
+// With returns a copy of l holding the named value.
+func (l LineFormat) With(name string, value float64) LineFormat {
+	l.Name = name
+	l.Value = value
+	return l
+}
 
-	if !k8s {
+// Record is a single value of a measurement with the account, plant,
+// inverter and tags it belongs to. It is the row every output format is built from, with
+// the JSON names used by the json, ndjson, yaml and csv outputs.
+type Record struct {
+	Measurement string            `json:"measurement"`
+	Time        time.Time         `json:"time"`
+	Account     string            `json:"account,omitempty"`
+	PlantId     int               `json:"plant_id"`
+	PlantName   string            `json:"plant_name,omitempty"`
+	Inverter    string            `json:"inverter,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Field       string            `json:"field"`
+	Value       float64           `json:"value"`
+	Unit        string            `json:"unit,omitempty"`
+}
 
-		SunsynkToken = os.Getenv("SS_TOKEN")
+// NewRecords returns rows as records of measurement, each a field named
+// after the lower cased Name.
+func NewRecords(measurement string, rows []LineFormat) []Record {
+
+	records := make([]Record, 0, len(rows))
+
+	for _, row := range rows {
+		records = append(records, Record{
+			Measurement: measurement,
+			Time:        time.Unix(row.Timestamp, 0),
+			Account:     row.Account,
+			PlantId:     row.PlantId,
+			PlantName:   row.PlantName,
+			Inverter:    row.Inverter,
+			Tags:        row.Tags,
+			Field:       strings.ToLower(row.Name),
+			Value:       row.Value,
+			Unit:        row.Unit,
+		})
+	}
 
-		if SunsynkToken == "" {
-			log.Fatal("No token found in env 1")
-		}
+	return records
+}
 
-		return SunsynkToken
+// EncodeRecords renders records as line protocol, tagged with the account,
+// plant and inverter; records of the same series and timestamp share one line.
+func EncodeRecords(records []Record) ([]string, error) {
 
-	} else {
+	points := make([]lineprotocol.Point, 0, len(records))
 
-		clientset, err := kube.Login()
-		if err != nil {
-			log.Fatal(err)
+	for _, r := range records {
+		tags := []lineprotocol.Tag{
+			{Key: "account", Value: r.Account},
+			{Key: "plant", Value: strconv.Itoa(r.PlantId)},
+			{Key: "plant_name", Value: r.PlantName},
+			{Key: "inverter", Value: r.Inverter},
 		}
-
-		result, err := kube.GetK8sSecret(clientset, "sunsynk-token", "sunsynk")
-		if err != nil {
-			log.Fatal(err)
+		for k, v := range r.Tags {
+			tags = append(tags, lineprotocol.Tag{Key: k, Value: v})
 		}
 
-		token, ok := result.Data["token"]
-		if !ok {
-			log.Fatal("token not found in secret data")
-		}
+		points = append(points, lineprotocol.Point{
+			Measurement: r.Measurement,
+			Tags:        tags,
+			Fields:      []lineprotocol.Field{{Key: r.Field, Value: r.Value}},
+			Time:        r.Time,
+		})
+	}
+
+	return lineEncoder().EncodeAll(lineprotocol.Group(points))
+}
 
-		SunsynkToken = string(token)
+// lineEncoder writes timestamps in the precision InfluxDB is told to expect.
+func lineEncoder() lineprotocol.Encoder {
 
-		return SunsynkToken
+	cfg, err := influxdb.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	return lineprotocol.Encoder{Precision: cfg.TimePrecision()}
 }
 
-func GetPlantIDs(k8s bool) string {
+// FatalAPIError logs err and exits, pointing the user at re-authentication
+// when the API rejected the token.
+func FatalAPIError(err error) {
 
-	var SunsynkToken, SunsynkPlantId string
+	switch {
+	case sunsynk.IsUnauthorized(err):
+		log.Fatalf("%v: token rejected, run `ssctl auth` to log in again", err)
+	case sunsynk.IsRateLimited(err):
+		log.Fatalf("%v: rate limited by the Sunsynk API, try again later", err)
+	default:
+		log.Fatal(err)
+	}
+}
 
-	if !k8s {
+// NewClient returns a Sunsynk API client using the given token source.
+func NewClient(tokens sunsynk.TokenSource) *sunsynk.Client {
 
-		SunsynkPlantId = os.Getenv("SS_PLANT_ID")
-		SunsynkToken = os.Getenv("SS_TOKEN")
+	client := sunsynk.NewClient(sunsynk.BaseURLFromEnv(), tokens)
+	client.UserAgent = "ssctl/" + Version
+	client.HTTPClient.Timeout = requestTimeout
+	client.Retry = utils.Retry
+	client.PageSize = pageSize
 
-		if SunsynkPlantId == "" {
-			log.Fatal("No plant ID found in env")
-		}
+	return client
+}
 
-		if SunsynkToken == "" {
-			log.Fatal("No token found in env 2")
-		}
+// NewAuthenticatedClient returns a client logged in to account, whose token
+// is loaded from, and refreshed into, Kubernetes secrets or the environment.
+func NewAuthenticatedClient(account Account, k8s bool) *sunsynk.Client {
 
-	} else {
+	client := NewClient(nil)
+	client.Tokens = NewTokenSource(client, account, k8s)
 
-		clientset, err := kube.Login()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		result, err := kube.GetK8sSecret(clientset, "sunsynk-user-plants", "sunsynk")
-		if err != nil {
-			log.Fatal(err)
-		}
+	return client
+}
 
-		plantdata, ok := result.Data["plants.json"]
-		if !ok {
-			log.Fatal("plants.json not found in secret data")
-		}
+// NewInfluxWriter returns an InfluxDB writer configured from the
+// INFLUXDB_* environment variables.
+func NewInfluxWriter() *influxdb.Writer {
 
-		var UserPlantsStruct []sunsynk.SSApiUserPlant
+	cfg, err := influxdb.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		err = json.Unmarshal(plantdata, &UserPlantsStruct)
-		if err != nil {
-			log.Fatal(err)
-		}
+	writer, err := influxdb.NewWriter(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer.HTTPClient.Timeout = requestTimeout
+	writer.Retry = utils.Retry
 
-		SunsynkPlantId = fmt.Sprint(UserPlantsStruct[0].Id)
+	return writer
+}
 
-		return SunsynkPlantId
+// NewVaultClient returns a Vault client configured from the VAULT_*
+// environment variables.
+func NewVaultClient() *vault.Client {
 
+	client, err := vault.NewClientFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
+	client.HTTPClient.Timeout = requestTimeout
+	client.Retry = utils.Retry
 
-	return SunsynkPlantId
-
+	return client
 }
 
-func GetInverterIDs(plantIds, token string) string {
+// Upload2influxdb writes line protocol to InfluxDB and exits on failure.
+func Upload2influxdb(ctx context.Context, data string) {
 
-	inverterId, err := sunsynk.GetInverterId(plantIds, token)
-	if err != nil {
+	if err := NewInfluxWriter().Write(ctx, data); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	var UserInvertersStruct sunsynk.SSApiPlantInverterDataResponse
+// UploadRecords writes records to InfluxDB as line protocol and exits on
+// failure.
+func UploadRecords(ctx context.Context, records []Record) {
 
-	err = json.Unmarshal(inverterId, &UserInvertersStruct)
+	lines, err := EncodeRecords(records)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	SunsynkInverterId := UserInvertersStruct.Data.Infos[0].Sn
+	Upload2influxdb(ctx, strings.Join(lines, "\n"))
+}
+
+// GetInverters returns every inverter attached to the plant.
+func GetInverters(ctx context.Context, client *sunsynk.Client, plantId string) []sunsynk.SSApiPlantInverterData {
 
-	return SunsynkInverterId
+	UserInvertersStruct, err := client.GetInverters(ctx, plantId)
+	if err != nil {
+		FatalAPIError(err)
+	}
+
+	if len(UserInvertersStruct.Data.Infos) == 0 {
+		log.Warnf("No inverters found for plant %s", plantId)
+	}
 
+	return UserInvertersStruct.Data.Infos
 }
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd fetches the chart of arbitrary inverter parameters
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Get the history of inverter parameters over a date range",
+	Long: `Get the time series of inverter parameters charted by the Sunsynk web UI.
+
+With --column the day chart of the columns is fetched for every day from
+--from to --to. With --params the parameters are fetched for the whole range
+in one request. Both take a comma separated list, e.g. --column pac or
+--params pv1_power,pv2_power.
+
+Each series becomes a field named after its label in the
+sunsynk_inverter_history measurement.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Root().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Root().PersistentFlags().GetBool("k8s")
+		uploadFlagValue, _ := cmd.Root().PersistentFlags().GetBool("upload")
+		tzFlagValue, _ := cmd.Flags().GetString("tz")
+		format := outputFormatFromFlags(cmd, OutputLine)
+
+		var opts HistoryOptions
+		opts.Column, _ = cmd.Flags().GetString("column")
+		opts.Params, _ = cmd.Flags().GetString("params")
+		opts.From, _ = cmd.Flags().GetString("from")
+		opts.To, _ = cmd.Flags().GetString("to")
+		opts.Inverters, _ = cmd.Flags().GetStringSlice("inverter")
+
+		if (opts.Column == "") == (opts.Params == "") {
+			log.Fatal("Give exactly one of --column and --params")
+		}
+
+		hdata := InverterHistory(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), tzFlagValue, opts)
+
+		if uploadFlagValue {
+			UploadRecords(cmd.Context(), hdata)
+		} else {
+			PrintRecords(format, hdata)
+		}
+	},
+}
+
+func init() {
+	inverterCmd.AddCommand(historyCmd)
+	historyCmd.Flags().String("column", "", "Comma separated day chart columns, e.g. pac")
+	historyCmd.Flags().String("params", "", "Comma separated parameters fetched for the whole range")
+	historyCmd.Flags().String("from", "", "First day, e.g. 2025-01-01 (default: today)")
+	historyCmd.Flags().String("to", "", "Last day (default: --from)")
+	historyCmd.Flags().StringSlice("inverter", nil, "Only these inverter serial numbers, may be repeated or comma separated")
+}
+
+// HistoryOptions selects the inverter series to fetch.
+type HistoryOptions struct {
+	Column    string
+	Params    string
+	From      string
+	To        string
+	Inverters []string
+}
+
+// InverterHistory returns the requested series of every inverter of every
+// selected plant. Dates are days in the plant's timezone.
+func InverterHistory(ctx context.Context, k8s bool, sel PlantSelector, tz string, opts HistoryOptions) []Record {
+
+	var historyRecords []Record
+
+	for _, account := range accounts {
+
+		client := NewAuthenticatedClient(account, k8s)
+
+		for _, plant := range GetPlants(ctx, client, account, k8s, sel) {
+
+			loc := PlantLocation(ctx, client, plant.Id, tz)
+
+			from, to := opts.From, opts.To
+			if from == "" {
+				from = time.Now().In(loc).Format("2006-01-02")
+			}
+			if to == "" {
+				to = from
+			}
+
+			dates, err := dateRange(from, to)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			for _, inverter := range GetInverters(ctx, client, strconv.Itoa(plant.Id)) {
+
+				if !selectedInverter(inverter.Sn, opts.Inverters) {
+					continue
+				}
+
+				if opts.Params != "" {
+					history, err := client.GetCustomInverterData(ctx, from, to, inverter.Sn, opts.Params)
+					if err != nil {
+						FatalAPIError(err)
+					}
+
+					output, err := History2Records(from, plant, inverter.Sn, loc, history.Data.Infos)
+					if err != nil {
+						log.Fatal(err)
+					}
+
+					historyRecords = append(historyRecords, account.label(output)...)
+					continue
+				}
+
+				for _, date := range dates {
+					history, err := client.GetInverterData(ctx, date, inverter.Sn, opts.Column)
+					if err != nil {
+						FatalAPIError(err)
+					}
+
+					output, err := History2Records(date, plant, inverter.Sn, loc, history.Data.Infos)
+					if err != nil {
+						log.Fatal(err)
+					}
+
+					historyRecords = append(historyRecords, account.label(output)...)
+				}
+			}
+		}
+	}
+
+	return historyRecords
+}
+
+func selectedInverter(sn string, selected []string) bool {
+
+	if len(selected) == 0 {
+		return true
+	}
+
+	for _, s := range selected {
+		if strings.EqualFold(strings.TrimSpace(s), sn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// History2Records converts inverter chart series into
+// sunsynk_inverter_history records. Record times are either wall-clock times
+// of a series starting on date or full dates and times, both in loc.
+func History2Records(date string, plant sunsynk.SSApiUserPlant, inverterSn string, loc *time.Location, series []sunsynk.SSApiPlantData) ([]Record, error) {
+
+	var rows []LineFormat
+
+	for _, s := range series {
+
+		name := fieldName(s.Label)
+		if name == "" {
+			name = fieldName(s.Id)
+		}
+
+		clock := newWallClock(loc)
+
+		for _, record := range s.Records {
+
+			value, err := strconv.ParseFloat(record.Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("inverter %s %s at %s: %w", inverterSn, s.Label, record.Time, err)
+			}
+
+			t, ok, err := recordTime(clock, date, record.Time)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				log.Debugf("Skipping %s %s %s, the time does not exist in %s", s.Label, date, record.Time, loc)
+				continue
+			}
+
+			rows = append(rows, LineFormat{
+				Name:      name,
+				Value:     value,
+				Unit:      s.Unit,
+				PlantId:   plant.Id,
+				PlantName: plant.Name,
+				Inverter:  inverterSn,
+				Timestamp: t.Unix(),
+			})
+		}
+	}
+
+	return NewRecords("sunsynk_inverter_history", rows), nil
+}
+
+// recordTime places a chart record time: a time of day of the series that
+// starts on date, or a date with an optional time.
+func recordTime(clock *wallClock, date, value string) (time.Time, bool, error) {
+
+	if len(value) == len("15:04") || len(value) == len("15:04:05") {
+		return clock.resolveSeries(date, value)
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if wall, err := time.Parse(layout, value); err == nil {
+			t, ok := clock.place(wall)
+			return t, ok, nil
+		}
+	}
+
+	return time.Time{}, false, fmt.Errorf("invalid record time %q", value)
+}
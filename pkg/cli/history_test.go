@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordTime(t *testing.T) {
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A series from 2024-03-30 over the start of summer time in London on
+	// the 31st, when 01:00 GMT became 02:00 BST.
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"22:00:00", "2024-03-30T22:00:00Z", true},
+		{"23:30:15", "2024-03-30T23:30:15Z", true},
+		{"00:30:00", "2024-03-31T00:30:00Z", true},
+		{"01:30:00", "", false},
+		{"02:30:00", "2024-03-31T01:30:00Z", true},
+		{"02:30:00", "2024-03-31T01:30:00Z", true},
+		{"23:00", "2024-03-31T22:00:00Z", true},
+		{"00:00", "2024-03-31T23:00:00Z", true},
+		{"2024-04-02 12:00:00", "2024-04-02T11:00:00Z", true},
+		{"2024-04-03", "2024-04-02T23:00:00Z", true},
+	}
+
+	clock := newWallClock(london)
+
+	for _, tt := range tests {
+
+		got, ok, err := recordTime(clock, "2024-03-30", tt.value)
+		if err != nil {
+			t.Fatalf("recordTime(%q): %v", tt.value, err)
+		}
+		if ok != tt.ok {
+			t.Fatalf("recordTime(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+		}
+		if ok && got.UTC().Format(time.RFC3339) != tt.want {
+			t.Errorf("recordTime(%q) = %s, want %s", tt.value, got.UTC().Format(time.RFC3339), tt.want)
+		}
+	}
+
+	if _, _, err := recordTime(newWallClock(london), "2024-03-30", "noon"); err == nil {
+		t.Error("recordTime(\"noon\") did not fail")
+	}
+}
@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssctl/pkg/lineprotocol"
+	"ssctl/pkg/sunsynk"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// inventoryCmd lists the plants, inverters and dataloggers of the account
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "List every plant, inverter and datalogger with its firmware",
+	Long: `List the inverters of each selected plant with their model, rated
+power, communication type, firmware versions (master, soft, hard, HMI and
+BMS) and the serial number and status of the datalogger they report
+through.
+
+The inventory is printed as a table unless --output says otherwise. With
+--upload it is written to InfluxDB as the sunsynk_inventory measurement,
+with the firmware versions as string fields, so a changed version can be
+alerted on.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		debugFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("debug")
+
+		if debugFlagValue {
+			os.Setenv("SS_DEBUG", "TRUE")
+		}
+
+		k8sFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("k8s")
+		uploadFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("upload")
+		format := outputFormatFromFlags(cmd, OutputTable)
+
+		devices := Inventory(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd))
+
+		if uploadFlagValue {
+			lines, err := Inventory2Line(devices)
+			if err != nil {
+				log.Fatal(err)
+			}
+			Upload2influxdb(cmd.Context(), strings.Join(lines, "\n"))
+			return
+		}
+
+		printOutput(format, devices, inventoryTable)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+	addPlantSelectorFlags(inventoryCmd.Flags())
+}
+
+// InventoryDevice is an inverter with the plant it belongs to and the
+// datalogger it reports through.
+type InventoryDevice struct {
+	Account       string    `json:"account,omitempty"`
+	PlantId       int       `json:"plant_id"`
+	PlantName     string    `json:"plant_name,omitempty"`
+	Sn            string    `json:"sn"`
+	Alias         string    `json:"alias,omitempty"`
+	Model         string    `json:"model,omitempty"`
+	RatedPower    int       `json:"rated_power"`
+	CommType      string    `json:"comm_type,omitempty"`
+	Status        int       `json:"status"`
+	MasterVer     string    `json:"master_ver,omitempty"`
+	SoftVer       string    `json:"soft_ver,omitempty"`
+	HardVer       string    `json:"hard_ver,omitempty"`
+	HmiVer        string    `json:"hmi_ver,omitempty"`
+	BmsVer        string    `json:"bms_ver,omitempty"`
+	GatewaySn     string    `json:"gateway_sn,omitempty"`
+	GatewayStatus int       `json:"gateway_status"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NewInventoryDevice returns the inventory entry of an inverter of plant.
+func NewInventoryDevice(account Account, plant sunsynk.SSApiUserPlant, inverter sunsynk.SSApiPlantInverterData) InventoryDevice {
+
+	gatewaySn := inverter.GatewayVO.Gsn
+	if gatewaySn == "" {
+		gatewaySn = inverter.Gsn
+	}
+
+	return InventoryDevice{
+		Account:       account.Name,
+		PlantId:       plant.Id,
+		PlantName:     plant.Name,
+		Sn:            inverter.Sn,
+		Alias:         inverter.Alias,
+		Model:         inverter.Model,
+		RatedPower:    inverter.RatePower,
+		CommType:      inverter.CommTypeName,
+		Status:        inverter.Status,
+		MasterVer:     inverter.Version.MasterVer,
+		SoftVer:       inverter.Version.SoftVer,
+		HardVer:       inverter.Version.HardVer,
+		HmiVer:        inverter.Version.HmiVer,
+		BmsVer:        inverter.Version.BmsVer,
+		GatewaySn:     gatewaySn,
+		GatewayStatus: inverter.GatewayVO.Status,
+		UpdatedAt:     inverter.UpdateAt,
+	}
+}
+
+// Inventory returns every inverter of every selected plant.
+func Inventory(ctx context.Context, k8s bool, sel PlantSelector) []InventoryDevice {
+
+	var devices []InventoryDevice
+
+	for _, account := range accounts {
+
+		client := NewAuthenticatedClient(account, k8s)
+
+		for _, plant := range GetPlants(ctx, client, account, k8s, sel) {
+
+			inverters, err := client.GetInverters(ctx, strconv.Itoa(plant.Id))
+			if err != nil {
+				FatalAPIError(err)
+			}
+
+			for _, inverter := range inverters.Data.Infos {
+				devices = append(devices, NewInventoryDevice(account, plant, inverter))
+			}
+		}
+	}
+
+	return devices
+}
+
+// Inventory2Line converts the inventory into sunsynk_inventory points
+// stamped with the current time.
+func Inventory2Line(devices []InventoryDevice) ([]string, error) {
+
+	now := time.Now()
+	points := make([]lineprotocol.Point, 0, len(devices))
+
+	for _, d := range devices {
+		points = append(points, lineprotocol.Point{
+			Measurement: "sunsynk_inventory",
+			Tags: []lineprotocol.Tag{
+				{Key: "account", Value: d.Account},
+				{Key: "plant", Value: strconv.Itoa(d.PlantId)},
+				{Key: "plant_name", Value: d.PlantName},
+				{Key: "inverter", Value: d.Sn},
+				{Key: "gateway", Value: d.GatewaySn},
+			},
+			Fields: []lineprotocol.Field{
+				{Key: "model", Value: d.Model},
+				{Key: "rated_power", Value: d.RatedPower},
+				{Key: "comm_type", Value: d.CommType},
+				{Key: "status", Value: d.Status},
+				{Key: "master_ver", Value: d.MasterVer},
+				{Key: "soft_ver", Value: d.SoftVer},
+				{Key: "hard_ver", Value: d.HardVer},
+				{Key: "hmi_ver", Value: d.HmiVer},
+				{Key: "bms_ver", Value: d.BmsVer},
+				{Key: "gateway_status", Value: d.GatewayStatus},
+			},
+			Time: now,
+		})
+	}
+
+	return lineEncoder().EncodeAll(points)
+}
+
+// inventoryTable lays the inventory out for the csv, table and line outputs.
+var inventoryTable = outputTable[InventoryDevice]{
+	columns: []string{
+		"plant_id", "plant_name", "sn", "alias", "model", "rated_power", "comm_type", "status",
+		"master_ver", "soft_ver", "hard_ver", "hmi_ver", "bms_ver", "gateway_sn", "gateway_status",
+	},
+	row: func(d InventoryDevice) []string {
+		return []string{
+			strconv.Itoa(d.PlantId), d.PlantName, d.Sn, d.Alias, d.Model, strconv.Itoa(d.RatedPower), d.CommType, strconv.Itoa(d.Status),
+			d.MasterVer, d.SoftVer, d.HardVer, d.HmiVer, d.BmsVer, d.GatewaySn, strconv.Itoa(d.GatewayStatus),
+		}
+	},
+	account: func(d InventoryDevice) string { return d.Account },
+	lines:   Inventory2Line,
+}
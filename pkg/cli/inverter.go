@@ -1,16 +1,13 @@
 package cli
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 	"ssctl/pkg/sunsynk"
-	"ssctl/pkg/utils"
 	"strconv"
-	"strings"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -34,13 +31,14 @@ to quickly create a Cobra application.`,
 
 		k8sFlagValue, _ := cmd.Parent().Parent().PersistentFlags().GetBool("k8s")
 		uploadFlagValue, _ := cmd.Parent().Parent().PersistentFlags().GetBool("upload")
+		format := outputFormatFromFlags(cmd, OutputLine)
 
-		idata := Inverter(k8sFlagValue)
+		idata := Inverter(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd))
 
 		if uploadFlagValue {
-			utils.Upload2influxdb(idata)
+			UploadRecords(cmd.Context(), idata)
 		} else {
-			fmt.Println(idata)
+			PrintRecords(format, idata)
 		}
 
 	},
@@ -59,46 +57,75 @@ func init() {
 	// inverterCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-func Inverter(k8s bool) string {
+// Inverter returns the grid realtime data of every inverter of every
+// selected plant.
+func Inverter(ctx context.Context, k8s bool, sel PlantSelector) []Record {
+	return InverterReadings(ctx, k8s, sel, "", readGrid)
+}
 
-	var gridRealtDataLineString, SunsynkToken, SunsynkPlantId string
+// inverterReading fetches one kind of realtime reading of an inverter and
+// converts it to records. loc returns the timezone of the plant, looked up
+// on first use and shared by all its inverters.
+type inverterReading func(ctx context.Context, client *sunsynk.Client, plant sunsynk.SSApiUserPlant, inverterSn string, loc func() *time.Location) ([]Record, error)
 
-	SunsynkToken = GetToken(k8s)
-	SunsynkPlantId = GetPlantIDs(k8s)
+// InverterReadings runs read for every inverter of every selected plant.
+func InverterReadings(ctx context.Context, k8s bool, sel PlantSelector, tz string, read inverterReading) []Record {
 
-	inverterId := GetInverterIDs(SunsynkPlantId, SunsynkToken)
+	var records []Record
 
-	gridRealtimeData, err := sunsynk.GetInverterGridRealtimeData(inverterId, SunsynkToken)
-	if err != nil {
-		log.Fatal(err)
-	}
+	for _, account := range accounts {
 
-	output, err := InverterGridRealtime2Line(SunsynkPlantId, gridRealtimeData)
-	if err != nil {
-		log.Fatal(err)
-	}
+		client := NewAuthenticatedClient(account, k8s)
 
-	gridRealtDataLineString = strings.Join(output, "\n")
+		for _, plant := range GetPlants(ctx, client, account, k8s, sel) {
 
-	return gridRealtDataLineString
-}
+			SunsynkPlantId := strconv.Itoa(plant.Id)
 
-func InverterGridRealtime2Line(plantID string, ssgridrealtimedata []byte) ([]string, error) {
+			var plantLoc *time.Location
+			loc := func() *time.Location {
+				if plantLoc == nil {
+					plantLoc = PlantLocation(ctx, client, plant.Id, tz)
+				}
+				return plantLoc
+			}
 
-	var gridrealtimedatastruct sunsynk.SSApiInverterGridRealtimeDataResponse
+			for _, inverter := range GetInverters(ctx, client, SunsynkPlantId) {
 
-	var gridRealtimeDataLineStruct []LineFormat
+				output, err := read(ctx, client, plant, inverter.Sn, loc)
+				if err != nil {
+					FatalAPIError(err)
+				}
+
+				records = append(records, account.label(output)...)
+			}
+		}
+	}
+
+	return records
+}
 
-	err := json.Unmarshal(ssgridrealtimedata, &gridrealtimedatastruct)
+func readGrid(ctx context.Context, client *sunsynk.Client, plant sunsynk.SSApiUserPlant, inverterSn string, loc func() *time.Location) ([]Record, error) {
+
+	gridRealtimeData, err := client.GetInverterGridRealtimeData(ctx, inverterSn)
 	if err != nil {
 		return nil, err
 	}
 
+	return InverterGridRealtime2Records(strconv.Itoa(plant.Id), plant.Name, inverterSn, gridRealtimeData)
+}
+
+// InverterGridRealtime2Records converts the grid realtime data of an
+// inverter into import and export counter records, stamped with the current
+// time.
+func InverterGridRealtime2Records(plantID, plantName, inverterSn string, gridrealtimedatastruct sunsynk.SSApiInverterGridRealtimeDataResponse) ([]Record, error) {
+
+	var gridRealtimeDataLineStruct []LineFormat
+
 	var gridFromToday, gridToToday, gridFromTotal, gridToTotal LineFormat
 
 	SunsynkPlantIdInt, err := strconv.Atoi(plantID)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("invalid plant ID %q", plantID)
 	}
 
 	gridFromToday.PlantId = SunsynkPlantIdInt
@@ -106,24 +133,34 @@ func InverterGridRealtime2Line(plantID string, ssgridrealtimedata []byte) ([]str
 	gridFromTotal.PlantId = SunsynkPlantIdInt
 	gridToTotal.PlantId = SunsynkPlantIdInt
 
-	gridFromToday.Value, err = strconv.ParseFloat(gridrealtimedatastruct.Data.ETodayFrom, 32)
+	gridFromToday.PlantName = plantName
+	gridToToday.PlantName = plantName
+	gridFromTotal.PlantName = plantName
+	gridToTotal.PlantName = plantName
+
+	gridFromToday.Inverter = inverterSn
+	gridToToday.Inverter = inverterSn
+	gridFromTotal.Inverter = inverterSn
+	gridToTotal.Inverter = inverterSn
+
+	gridFromToday.Value, err = strconv.ParseFloat(gridrealtimedatastruct.Data.ETodayFrom, 64)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("inverter %s: %w", inverterSn, err)
 	}
 
-	gridToToday.Value, err = strconv.ParseFloat(gridrealtimedatastruct.Data.ETodayTo, 32)
+	gridToToday.Value, err = strconv.ParseFloat(gridrealtimedatastruct.Data.ETodayTo, 64)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("inverter %s: %w", inverterSn, err)
 	}
 
-	gridFromTotal.Value, err = strconv.ParseFloat(gridrealtimedatastruct.Data.ETotalFrom, 32)
+	gridFromTotal.Value, err = strconv.ParseFloat(gridrealtimedatastruct.Data.ETotalFrom, 64)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("inverter %s: %w", inverterSn, err)
 	}
 
-	gridToTotal.Value, err = strconv.ParseFloat(gridrealtimedatastruct.Data.ETotalTo, 32)
+	gridToTotal.Value, err = strconv.ParseFloat(gridrealtimedatastruct.Data.ETotalTo, 64)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("inverter %s: %w", inverterSn, err)
 	}
 
 	gridFromToday.Name = "import_today"
@@ -144,12 +181,6 @@ func InverterGridRealtime2Line(plantID string, ssgridrealtimedata []byte) ([]str
 	gridRealtimeDataLineStruct = append(gridRealtimeDataLineStruct, gridFromTotal)
 	gridRealtimeDataLineStruct = append(gridRealtimeDataLineStruct, gridToTotal)
 
-	var gridRealtimeDataLineStringSlice []string
-
-	for _, line := range gridRealtimeDataLineStruct {
-		gridRealtimeDataLineStringSlice = append(gridRealtimeDataLineStringSlice, "sunsynk_inverter_grid_realtime,plant="+fmt.Sprint(line.PlantId)+" "+strings.ToLower(line.Name)+"="+strconv.FormatFloat(line.Value, 'f', 2, 64)+" "+fmt.Sprint(line.Timestamp))
-	}
-
-	return gridRealtimeDataLineStringSlice, err
+	return NewRecords("sunsynk_inverter_grid_realtime", gridRealtimeDataLineStruct), nil
 
 }
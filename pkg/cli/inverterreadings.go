@@ -0,0 +1,277 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"ssctl/pkg/sunsynk"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	inverterCmd.AddCommand(
+		newInverterReadingCmd("pv", "Get the PV input of every inverter, per MPPT", readPV),
+		newInverterReadingCmd("battery", "Get the battery state of every inverter", readBattery),
+		newInverterReadingCmd("load", "Get the load consumption of every inverter", readLoad),
+		newInverterReadingCmd("output", "Get the AC output and temperatures of every inverter", readOutput),
+	)
+}
+
+// newInverterReadingCmd returns a `plant inverter` subcommand printing or
+// uploading the readings produced by read.
+func newInverterReadingCmd(use, short string, read inverterReading) *cobra.Command {
+
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			debugFlagValue, _ := cmd.Root().PersistentFlags().GetBool("debug")
+
+			if debugFlagValue {
+				os.Setenv("SS_DEBUG", "TRUE")
+			}
+
+			k8sFlagValue, _ := cmd.Root().PersistentFlags().GetBool("k8s")
+			uploadFlagValue, _ := cmd.Root().PersistentFlags().GetBool("upload")
+			tzFlagValue, _ := cmd.Flags().GetString("tz")
+			format := outputFormatFromFlags(cmd, OutputLine)
+
+			data := InverterReadings(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), tzFlagValue, read)
+
+			if uploadFlagValue {
+				UploadRecords(cmd.Context(), data)
+			} else {
+				PrintRecords(format, data)
+			}
+		},
+	}
+}
+
+// inverterRow returns the row every reading of the inverter starts from,
+// stamped with the current time.
+func inverterRow(plant sunsynk.SSApiUserPlant, inverterSn string) LineFormat {
+	return LineFormat{
+		PlantId:   plant.Id,
+		PlantName: plant.Name,
+		Inverter:  inverterSn,
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+// phaseRows returns the voltage, current and power of each phase, tagged
+// with the phase number.
+func phaseRows(row LineFormat, phases []sunsynk.SSApiInverterPhase) []LineFormat {
+
+	var rows []LineFormat
+
+	for i, phase := range phases {
+		row.Tags = map[string]string{"phase": strconv.Itoa(i + 1)}
+		rows = append(rows,
+			row.With("volt", float64(phase.Volt)),
+			row.With("current", float64(phase.Current)),
+			row.With("power", float64(phase.Power)),
+		)
+	}
+
+	return rows
+}
+
+func readPV(ctx context.Context, client *sunsynk.Client, plant sunsynk.SSApiUserPlant, inverterSn string, loc func() *time.Location) ([]Record, error) {
+
+	input, err := client.GetInverterInputRealtimeData(ctx, inverterSn)
+	if err != nil {
+		return nil, err
+	}
+
+	return InverterPV2Records(plant, inverterSn, input.Data)
+}
+
+// InverterPV2Records converts the PV input of an inverter into total
+// records and records per MPPT.
+func InverterPV2Records(plant sunsynk.SSApiUserPlant, inverterSn string, data sunsynk.SSApiInverterInputRealtimeData) ([]Record, error) {
+
+	row := inverterRow(plant, inverterSn)
+
+	rows := []LineFormat{
+		row.With("pac", float64(data.Pac)),
+		row.With("etoday", data.Etoday),
+		row.With("etotal", data.Etotal),
+	}
+
+	for _, pv := range data.PvIV {
+
+		mppt := row
+		mppt.Tags = map[string]string{"mppt": strconv.Itoa(pv.PvNo)}
+
+		rows = append(rows,
+			mppt.With("volt", float64(pv.Vpv)),
+			mppt.With("current", float64(pv.Ipv)),
+			mppt.With("power", float64(pv.Ppv)),
+			mppt.With("today", float64(pv.TodayPv)),
+		)
+	}
+
+	return NewRecords("sunsynk_inverter_pv", rows), nil
+}
+
+func readBattery(ctx context.Context, client *sunsynk.Client, plant sunsynk.SSApiUserPlant, inverterSn string, loc func() *time.Location) ([]Record, error) {
+
+	battery, err := client.GetInverterBatteryRealtimeData(ctx, inverterSn)
+	if err != nil {
+		return nil, err
+	}
+
+	return InverterBattery2Records(plant, inverterSn, battery.Data)
+}
+
+// InverterBattery2Records converts the battery state of an inverter into
+// records.
+func InverterBattery2Records(plant sunsynk.SSApiUserPlant, inverterSn string, data sunsynk.SSApiInverterBatteryRealtimeData) ([]Record, error) {
+
+	row := inverterRow(plant, inverterSn)
+
+	return NewRecords("sunsynk_inverter_battery", []LineFormat{
+		row.With("soc", float64(data.Soc)),
+		row.With("voltage", float64(data.Voltage)),
+		row.With("current", float64(data.Current)),
+		row.With("power", float64(data.Power)),
+		row.With("temp", float64(data.Temp)),
+		row.With("capacity", float64(data.Capacity)),
+		row.With("bms_soc", float64(data.BmsSoc)),
+		row.With("bms_voltage", float64(data.BmsVolt)),
+		row.With("bms_current", float64(data.BmsCurrent)),
+		row.With("bms_temp", float64(data.BmsTemp)),
+		row.With("charge_today", float64(data.EtodayChg)),
+		row.With("discharge_today", float64(data.EtodayDischg)),
+		row.With("charge_total", float64(data.EtotalChg)),
+		row.With("discharge_total", float64(data.EtotalDischg)),
+	}), nil
+}
+
+func readLoad(ctx context.Context, client *sunsynk.Client, plant sunsynk.SSApiUserPlant, inverterSn string, loc func() *time.Location) ([]Record, error) {
+
+	load, err := client.GetInverterLoadRealtimeData(ctx, inverterSn)
+	if err != nil {
+		return nil, err
+	}
+
+	return InverterLoad2Records(plant, inverterSn, load.Data)
+}
+
+// InverterLoad2Records converts the load readings of an inverter into total
+// records and records per phase.
+func InverterLoad2Records(plant sunsynk.SSApiUserPlant, inverterSn string, data sunsynk.SSApiInverterLoadRealtimeData) ([]Record, error) {
+
+	row := inverterRow(plant, inverterSn)
+
+	rows := []LineFormat{
+		row.With("power", float64(data.TotalPower)),
+		row.With("today", float64(data.DailyUsed)),
+		row.With("total", float64(data.TotalUsed)),
+		row.With("ups_power", float64(data.UpsPowerTotal)),
+		row.With("pf", float64(data.Pf)),
+		row.With("fac", float64(data.LoadFac)),
+	}
+	rows = append(rows, phaseRows(row, data.Vip)...)
+
+	return NewRecords("sunsynk_inverter_load", rows), nil
+}
+
+func readOutput(ctx context.Context, client *sunsynk.Client, plant sunsynk.SSApiUserPlant, inverterSn string, loc func() *time.Location) ([]Record, error) {
+
+	output, err := client.GetInverterOutputRealtimeData(ctx, inverterSn)
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now().In(loc()).Format("2006-01-02")
+
+	temps, err := client.GetInverterOutputDayData(ctx, today, inverterSn, sunsynk.InverterTemperatureColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return InverterOutput2Records(plant, inverterSn, output.Data, today, loc(), temps.Data.Infos)
+}
+
+// InverterOutput2Records converts the AC output of an inverter, together with
+// the latest temperatures of its output day chart for date, into total
+// records and records per phase. The temperatures are stamped with the time
+// of their chart point in loc rather than the current time.
+func InverterOutput2Records(plant sunsynk.SSApiUserPlant, inverterSn string, data sunsynk.SSApiInverterOutputRealtimeData, date string, loc *time.Location, temps []sunsynk.SSApiPlantData) ([]Record, error) {
+
+	row := inverterRow(plant, inverterSn)
+
+	rows := []LineFormat{
+		row.With("pinv", float64(data.PInv)),
+		row.With("pac", float64(data.Pac)),
+		row.With("fac", float64(data.Fac)),
+	}
+
+	for _, temp := range temps {
+
+		value, at, ok, err := latestReading(date, loc, temp.Records)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", temp.Label, err)
+		}
+		if !ok {
+			continue
+		}
+
+		reading := row
+		reading.Timestamp = at.Unix()
+		rows = append(rows, reading.With(fieldName(temp.Label), value))
+	}
+
+	rows = append(rows, phaseRows(row, data.Vip)...)
+
+	return NewRecords("sunsynk_inverter_output", rows), nil
+}
+
+// latestReading returns the last reading of a chart series of date, with
+// its time in loc. Readings the inverter left blank, such as "" or "--"
+// while it is idle, and readings at times that do not exist in loc are
+// passed over.
+func latestReading(date string, loc *time.Location, records []sunsynk.SSApiPlantRecord) (value float64, at time.Time, ok bool, err error) {
+
+	// Every point goes through the clock, in order, so that repeated times
+	// when the clocks go back are told apart.
+	clock := newWallClock(loc)
+
+	for _, record := range records {
+
+		t, exists, err := recordTime(clock, date, record.Time)
+		if err != nil {
+			return 0, time.Time{}, false, err
+		}
+
+		v, err := strconv.ParseFloat(record.Value, 64)
+		if err != nil || !exists {
+			continue
+		}
+
+		value, at, ok = v, t, true
+	}
+
+	return value, at, ok, nil
+}
+
+// fieldName turns a chart label such as "DC Temp" into dc_temp.
+func fieldName(label string) string {
+
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, label)
+
+	return strings.Trim(name, "_")
+}
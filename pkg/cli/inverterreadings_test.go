@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+)
+
+func TestLatestReading(t *testing.T) {
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type point struct{ time, value string }
+	records := func(points ...point) []sunsynk.SSApiPlantRecord {
+		var r []sunsynk.SSApiPlantRecord
+		for _, p := range points {
+			r = append(r, sunsynk.SSApiPlantRecord{Time: p.time, Value: p.value})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		date    string
+		records []sunsynk.SSApiPlantRecord
+		want    float64
+		wantAt  string
+		ok      bool
+	}{
+		{name: "empty", date: "2024-06-01"},
+		{
+			name:    "last",
+			date:    "2024-06-01",
+			records: records(point{"08:00", "30"}, point{"08:05", "31.5"}),
+			want:    31.5,
+			wantAt:  "2024-06-01T07:05:00Z",
+			ok:      true,
+		},
+		{
+			name:    "blank last",
+			date:    "2024-06-01",
+			records: records(point{"08:00", "30"}, point{"08:05", "31"}, point{"08:10", ""}),
+			want:    31,
+			wantAt:  "2024-06-01T07:05:00Z",
+			ok:      true,
+		},
+		{
+			name:    "dashes",
+			date:    "2024-06-01",
+			records: records(point{"08:00", "29"}, point{"08:05", "--"}, point{"08:10", "--"}),
+			want:    29,
+			wantAt:  "2024-06-01T07:00:00Z",
+			ok:      true,
+		},
+		{
+			name:    "all blank",
+			date:    "2024-06-01",
+			records: records(point{"08:00", ""}, point{"08:05", "--"}),
+		},
+		{
+			name:    "second pass when clocks go back",
+			date:    "2024-10-27",
+			records: records(point{"01:30", "20"}, point{"01:00", "21"}, point{"01:30", "22"}),
+			want:    22,
+			wantAt:  "2024-10-27T01:30:00Z",
+			ok:      true,
+		},
+		{
+			name:    "time skipped when clocks go forward",
+			date:    "2024-03-31",
+			records: records(point{"00:30", "18"}, point{"01:30", "19"}),
+			want:    18,
+			wantAt:  "2024-03-31T00:30:00Z",
+			ok:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, at, ok, err := latestReading(tt.date, london, tt.records)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("latestReading = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+			if ok && at.UTC().Format(time.RFC3339) != tt.wantAt {
+				t.Errorf("at = %s, want %s", at.UTC().Format(time.RFC3339), tt.wantAt)
+			}
+		})
+	}
+
+	if _, _, _, err := latestReading("2024-06-01", london, records(point{"noon", "30"})); err == nil {
+		t.Error("latestReading with an invalid time did not fail")
+	}
+}
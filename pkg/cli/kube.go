@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"os"
+
+	"ssctl/pkg/kube"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+)
+
+// kubeNamespace and kubeSecretNames locate the secrets in Kubernetes mode;
+// they are set from the flags and environment before any command runs.
+// kubeClientset is logged in on first use.
+var (
+	kubeNamespace   = kube.DefaultNamespace
+	kubeSecretNames = kube.DefaultSecretNames
+	kubeClientset   *kubernetes.Clientset
+)
+
+func addKubeFlags(flags *pflag.FlagSet) {
+	flags.String("namespace", "", "Namespace of the secrets in Kubernetes mode, also $SS_NAMESPACE (default \""+kube.DefaultNamespace+"\")")
+	flags.String("credentials-secret", "", "Secret holding the username and password, also $SS_CREDENTIALS_SECRET (default \""+kube.DefaultSecretNames.Credentials+"\")")
+	flags.String("token-secret", "", "Secret the token is kept in, also $SS_TOKEN_SECRET (default \""+kube.DefaultSecretNames.Token+"\")")
+	flags.String("plants-secret", "", "Secret the plant list is kept in, also $SS_PLANTS_SECRET (default \""+kube.DefaultSecretNames.Plants+"\")")
+}
+
+// kubeSettingsFromFlags sets the namespace and secret names from the flags,
+// falling back to the environment and then the defaults.
+func kubeSettingsFromFlags(cmd *cobra.Command) {
+
+	setting := func(flag, env, def string) string {
+		if value, _ := cmd.Flags().GetString(flag); value != "" {
+			return value
+		}
+		if value := os.Getenv(env); value != "" {
+			return value
+		}
+		return def
+	}
+
+	kubeNamespace = setting("namespace", "SS_NAMESPACE", kube.DefaultNamespace)
+	kubeSecretNames = kube.SecretNames{
+		Credentials: setting("credentials-secret", "SS_CREDENTIALS_SECRET", kube.DefaultSecretNames.Credentials),
+		Token:       setting("token-secret", "SS_TOKEN_SECRET", kube.DefaultSecretNames.Token),
+		Plants:      setting("plants-secret", "SS_PLANTS_SECRET", kube.DefaultSecretNames.Plants),
+	}
+}
+
+// kubeStore returns the store of the secrets of account, whose names carry
+// the account name as a suffix.
+func kubeStore(account Account) *kube.Store {
+
+	if kubeClientset == nil {
+		clientset, err := kube.Login()
+		if err != nil {
+			log.Fatal(err)
+		}
+		kubeClientset = clientset
+	}
+
+	return &kube.Store{
+		Clientset: kubeClientset,
+		Namespace: kubeNamespace,
+		Names:     kubeSecretNames.WithSuffix(account.Name),
+	}
+}
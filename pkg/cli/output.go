@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// OutputFormat is how a command prints its results, chosen with --output.
+type OutputFormat string
+
+const (
+	OutputLine   OutputFormat = "line"
+	OutputJSON   OutputFormat = "json"
+	OutputNDJSON OutputFormat = "ndjson"
+	OutputCSV    OutputFormat = "csv"
+	OutputTable  OutputFormat = "table"
+	OutputYAML   OutputFormat = "yaml"
+)
+
+// OutputFormats lists every format in the order they are documented.
+var OutputFormats = []OutputFormat{OutputJSON, OutputNDJSON, OutputCSV, OutputTable, OutputYAML, OutputLine}
+
+// Valid reports whether f is one of the known formats.
+func (f OutputFormat) Valid() bool {
+	for _, known := range OutputFormats {
+		if f == known {
+			return true
+		}
+	}
+	return false
+}
+
+// outputFormatFromFlags returns the --output format, or def when it was not
+// given. Unknown formats are fatal.
+func outputFormatFromFlags(cmd *cobra.Command, def OutputFormat) OutputFormat {
+
+	value, _ := cmd.Root().PersistentFlags().GetString("output")
+	if value == "" {
+		return def
+	}
+
+	format := OutputFormat(strings.ToLower(value))
+	if !format.Valid() {
+		log.Fatalf("Unknown output format %q, expected one of %s", value, joinFormats(OutputFormats))
+	}
+
+	return format
+}
+
+func joinFormats(formats []OutputFormat) string {
+
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = string(f)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// outputTable describes how items of type T are printed in the row based
+// formats. columns are the CSV header, upper cased for tables; account, when
+// set, adds a leading account column while named accounts are in use; lines,
+// when set, renders the items as line protocol.
+type outputTable[T any] struct {
+	columns []string
+	row     func(T) []string
+	account func(T) string
+	lines   func([]T) ([]string, error)
+}
+
+// header returns the columns of the table, with the account column when it
+// is shown.
+func (t outputTable[T]) header() []string {
+
+	if t.account == nil || !multiAccount() {
+		return t.columns
+	}
+
+	return append([]string{"account"}, t.columns...)
+}
+
+// cells returns the row of item, with its account when it is shown.
+func (t outputTable[T]) cells(item T) []string {
+
+	if t.account == nil || !multiAccount() {
+		return t.row(item)
+	}
+
+	return append([]string{t.account(item)}, t.row(item)...)
+}
+
+// writeOutput prints items to w in format. json, ndjson and yaml use the
+// JSON names of T so that every format shows the same field names.
+func writeOutput[T any](w io.Writer, format OutputFormat, items []T, table outputTable[T]) error {
+
+	switch format {
+
+	case OutputJSON:
+		if items == nil {
+			items = []T{}
+		}
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+
+	case OutputNDJSON:
+		enc := json.NewEncoder(w)
+		for _, item := range items {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case OutputYAML:
+		if items == nil {
+			items = []T{}
+		}
+		data, err := yaml.Marshal(items)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+
+	case OutputCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(table.header())
+		for _, item := range items {
+			cw.Write(table.cells(item))
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case OutputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		columns := table.header()
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = strings.ToUpper(strings.ReplaceAll(column, "_", " "))
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, item := range items {
+			fmt.Fprintln(tw, strings.Join(table.cells(item), "\t"))
+		}
+		return tw.Flush()
+
+	case OutputLine:
+		if table.lines == nil {
+			return fmt.Errorf("line protocol output is not available for this command")
+		}
+		lines, err := table.lines(items)
+		if err != nil {
+			return err
+		}
+		if len(lines) > 0 {
+			_, err = fmt.Fprintln(w, strings.Join(lines, "\n"))
+		}
+		return err
+	}
+
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// printOutput prints items to stdout and exits on failure.
+func printOutput[T any](format OutputFormat, items []T, table outputTable[T]) {
+
+	if err := writeOutput(os.Stdout, format, items, table); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// recordColumns are the fixed columns of records; the keys of their tags
+// follow the inverter column.
+var recordColumns = []string{"measurement", "time", "plant_id", "plant_name", "inverter", "field", "value", "unit"}
+
+// recordTable lays records out with a column per tag key found in them, so
+// that every row has the same columns.
+func recordTable(records []Record) outputTable[Record] {
+
+	keys := map[string]bool{}
+	for _, r := range records {
+		for k := range r.Tags {
+			keys[k] = true
+		}
+	}
+
+	var tagKeys []string
+	for k := range keys {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+
+	columns := append([]string{}, recordColumns[:5]...)
+	columns = append(columns, tagKeys...)
+	columns = append(columns, recordColumns[5:]...)
+
+	return outputTable[Record]{
+		columns: columns,
+		row: func(r Record) []string {
+			row := []string{
+				r.Measurement,
+				r.Time.UTC().Format(time.RFC3339),
+				strconv.Itoa(r.PlantId),
+				r.PlantName,
+				r.Inverter,
+			}
+			for _, k := range tagKeys {
+				row = append(row, r.Tags[k])
+			}
+			return append(row,
+				r.Field,
+				strconv.FormatFloat(r.Value, 'f', -1, 64),
+				r.Unit,
+			)
+		},
+		account: func(r Record) string { return r.Account },
+		lines:   EncodeRecords,
+	}
+}
+
+// PrintRecords prints records in format.
+func PrintRecords(format OutputFormat, records []Record) {
+	printOutput(format, records, recordTable(records))
+}
@@ -1,16 +1,13 @@
 package cli
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
-	"ssctl/pkg/kube"
 	"ssctl/pkg/sunsynk"
-	"ssctl/pkg/utils"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -37,12 +34,15 @@ to quickly create a Cobra application.`,
 		k8sFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("k8s")
 		uploadFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("upload")
 
-		pdata := Plant(k8sFlagValue)
+		tzFlagValue, _ := cmd.Flags().GetString("tz")
+		format := outputFormatFromFlags(cmd, OutputLine)
+
+		pdata := Plant(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), tzFlagValue)
 
 		if uploadFlagValue {
-			utils.Upload2influxdb(pdata)
+			UploadRecords(cmd.Context(), pdata)
 		} else {
-			fmt.Println(pdata)
+			PrintRecords(format, pdata)
 		}
 
 	},
@@ -50,6 +50,8 @@ to quickly create a Cobra application.`,
 
 func init() {
 	rootCmd.AddCommand(plantCmd)
+	addPlantSelectorFlags(plantCmd.PersistentFlags())
+	plantCmd.PersistentFlags().String("tz", "", "IANA timezone of the plant, e.g. Europe/London (default: from the plant settings)")
 
 	// Here you will define your flags and configuration settings.
 
@@ -61,125 +63,80 @@ func init() {
 	// is called directly, e.g.:
 }
 
-func Plant(k8s bool) string {
+// Plant returns today's chart data of every selected plant. "Today" and the
+// record times are in the plant's timezone, see PlantLocation.
+func Plant(ctx context.Context, k8s bool, sel PlantSelector, tz string) []Record {
 
-	var plantDataLineString, SunsynkToken, SunsynkPlantId string
+	var plantDataRecords []Record
 
-	today := time.Now().UTC().Format("2006-01-02")
 	dateOverride := os.Getenv("SS_DATE")
 
 	if dateOverride != "" {
 		log.Println("Date override", dateOverride)
-		today = dateOverride
 	}
 
-	if !k8s {
-
-		SunsynkPlantId = os.Getenv("SS_PLANT_ID")
-		SunsynkToken = os.Getenv("SS_TOKEN")
-
-		if SunsynkPlantId == "" {
-			log.Fatal("No plant ID found in env")
-		}
-
-		if SunsynkToken == "" {
-			log.Fatal("No token found in env 3")
-		}
+	for _, account := range accounts {
 
-	} else {
+		client := NewAuthenticatedClient(account, k8s)
 
-		clientset, err := kube.Login()
-		if err != nil {
-			log.Fatal(err)
-		}
+		for _, plant := range GetPlants(ctx, client, account, k8s, sel) {
 
-		result, err := kube.GetK8sSecret(clientset, "sunsynk-token", "sunsynk")
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		token, ok := result.Data["token"]
-		if !ok {
-			log.Fatal("token not found in secret data")
-		}
+			loc := PlantLocation(ctx, client, plant.Id, tz)
 
-		SunsynkToken = string(token)
-
-		result, err = kube.GetK8sSecret(clientset, "sunsynk-user-plants", "sunsynk")
-		if err != nil {
-			log.Fatal(err)
-		}
+			today := time.Now().In(loc).Format("2006-01-02")
+			if dateOverride != "" {
+				today = dateOverride
+			}
 
-		plantdata, ok := result.Data["plants.json"]
-		if !ok {
-			log.Fatal("plants.json not found in secret data")
-		}
+			plantdata, err := client.GetPlantData(ctx, today, strconv.Itoa(plant.Id))
+			if err != nil {
+				FatalAPIError(err)
+			}
 
-		var UserPlantsStruct []sunsynk.SSApiUserPlant
+			output, err := Plant2Records(today, plant.Id, plant.Name, loc, plantdata)
+			if err != nil {
+				log.Fatal(err)
+			}
 
-		err = json.Unmarshal(plantdata, &UserPlantsStruct)
-		if err != nil {
-			log.Fatal(err)
+			plantDataRecords = append(plantDataRecords, account.label(output)...)
 		}
-
-		SunsynkPlantId = fmt.Sprint(UserPlantsStruct[0].Id)
-
-	}
-
-	plantdata, err := sunsynk.GetPlantData(today, SunsynkPlantId, SunsynkToken)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	SunsynkPlantIdInt, err := strconv.Atoi(SunsynkPlantId)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	output, err := Plant2Line(today, SunsynkPlantIdInt, plantdata)
-	if err != nil {
-		log.Fatal(err)
 	}
 
-	plantDataLineString = strings.Join(output, "\n")
-
-	return plantDataLineString
+	return plantDataRecords
 
 }
 
-func Plant2Line(date string, plantID int, ssplantdata []byte) ([]string, error) {
-
-	var plantdatastruct sunsynk.SSApiPlantDataResponse
+// Plant2Records converts the day chart of a plant into sunsynk_plant
+// records. Record times are wall-clock times in loc on the given date.
+func Plant2Records(date string, plantID int, plantName string, loc *time.Location, plantdatastruct sunsynk.SSApiPlantDataResponse) ([]Record, error) {
 
 	var plantDataLineStruct []LineFormat
-
-	err := json.Unmarshal(ssplantdata, &plantdatastruct)
-	if err != nil {
-		log.Fatal(err)
-	}
+	var err error
 
 	for _, types := range plantdatastruct.Data.Infos {
 
+		clock := newWallClock(loc)
+
 		for _, datum := range types.Records {
 
 			var row LineFormat
 			row.Name = types.Label
 			row.PlantId = plantID
+			row.PlantName = plantName
 			row.Unit = types.Unit
 
-			row.Value, err = strconv.ParseFloat(datum.Value, 32)
+			row.Value, err = strconv.ParseFloat(datum.Value, 64)
 			if err != nil {
-				log.Fatal(err)
+				return nil, fmt.Errorf("plant %d %s at %s %s: %w", plantID, types.Label, date, datum.Time, err)
 			}
 
-			dateTimeStr := date + "T" + datum.Time + ":00Z" // combine date and time strings
-			//need to handle BST here?
-			//dateTimeStr := date + "T" + datum.Time + ":00+01:00" // combine date and time strings
-
-			// Parse dateTimeStr into a time.Time struct
-			dateTime, err := time.Parse(time.RFC3339, dateTimeStr)
+			dateTime, ok, err := clock.resolve(date, datum.Time)
 			if err != nil {
-				log.Fatal("Error parsing date and time:", err)
+				return nil, err
+			}
+			if !ok {
+				log.Debugf("Skipping %s %s %s, the time does not exist in %s", types.Label, date, datum.Time, loc)
+				continue
 			}
 
 			row.Timestamp = dateTime.Unix()
@@ -188,14 +145,8 @@ func Plant2Line(date string, plantID int, ssplantdata []byte) ([]string, error)
 
 	}
 
-	var plantDataLineStringSlice []string
-
-	for _, line := range plantDataLineStruct {
-		plantDataLineStringSlice = append(plantDataLineStringSlice, "sunsynk_plant,plant="+fmt.Sprint(line.PlantId)+" "+strings.ToLower(line.Name)+"="+strconv.FormatFloat(line.Value, 'f', 2, 64)+" "+fmt.Sprint(line.Timestamp))
-	}
-
-	// sunsynk_mppt_1,plant=123456 voltage=206,current=4 1682017085
+	// sunsynk_plant,plant=123456,plant_name=Home load=52,pv=104 1682017085
 
-	return plantDataLineStringSlice, err
+	return NewRecords("sunsynk_plant", plantDataLineStruct), nil
 
 }
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+)
+
+// cachedPlant is a selected plant with its timezone and the serial numbers
+// of its inverters, together with their details as last listed.
+type cachedPlant struct {
+	plant     sunsynk.SSApiUserPlant
+	loc       *time.Location
+	inverters []string
+	devices   []sunsynk.SSApiPlantInverterData
+}
+
+// plantCache keeps the selected plants and their inverters in memory, so
+// long running commands only list them when refreshed.
+type plantCache struct {
+	client *sunsynk.Client
+	sel    PlantSelector
+	tz     string
+
+	mu     sync.Mutex
+	plants []cachedPlant
+}
+
+// plantChanges lists the plants and inverters dropped by a refresh.
+type plantChanges struct {
+	plants    []int
+	inverters []string
+}
+
+func (c *plantCache) Plants() []cachedPlant {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]cachedPlant(nil), c.plants...)
+}
+
+// Refresh lists the plants of the account and the inverters of each
+// selected plant. When the inverters of a plant cannot be listed the
+// previous list is kept; every failed call is part of the returned error.
+func (c *plantCache) Refresh(ctx context.Context) (plantChanges, error) {
+
+	var changes plantChanges
+
+	userdata, err := c.client.GetUserPlants(ctx)
+	if err != nil {
+		return changes, err
+	}
+
+	previous := map[int]cachedPlant{}
+	for _, p := range c.Plants() {
+		previous[p.plant.Id] = p
+	}
+
+	var plants []cachedPlant
+	var errs []error
+
+	for _, plant := range c.sel.Filter(userdata.Data.Infos) {
+
+		p := cachedPlant{plant: plant}
+
+		if old, ok := previous[plant.Id]; ok {
+			p.loc = old.loc
+			p.inverters = old.inverters
+			p.devices = old.devices
+			delete(previous, plant.Id)
+		} else {
+			p.loc = PlantLocation(ctx, c.client, plant.Id, c.tz)
+		}
+
+		inverters, err := c.client.GetInverters(ctx, strconv.Itoa(plant.Id))
+		if err != nil {
+			errs = append(errs, err)
+			plants = append(plants, p)
+			continue
+		}
+
+		current := map[string]bool{}
+		for _, inverter := range inverters.Data.Infos {
+			current[inverter.Sn] = true
+		}
+		for _, sn := range p.inverters {
+			if !current[sn] {
+				changes.inverters = append(changes.inverters, sn)
+			}
+		}
+
+		p.devices = inverters.Data.Infos
+		p.inverters = nil
+		for _, inverter := range inverters.Data.Infos {
+			p.inverters = append(p.inverters, inverter.Sn)
+		}
+
+		plants = append(plants, p)
+	}
+
+	for id := range previous {
+		changes.plants = append(changes.plants, id)
+	}
+
+	c.mu.Lock()
+	c.plants = plants
+	c.mu.Unlock()
+
+	return changes, errors.Join(errs...)
+}
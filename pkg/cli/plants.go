@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"ssctl/pkg/sunsynk"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// PlantSelector picks which of the account's plants a command works on.
+// Without any selection SS_PLANT_ID is used, or in Kubernetes mode every
+// plant stored in the plants secret.
+type PlantSelector struct {
+	IDs   []string
+	Names []string
+	All   bool
+}
+
+func addPlantSelectorFlags(flags *pflag.FlagSet) {
+	flags.StringSlice("plant-id", nil, "Plant ID to use, may be repeated or comma separated")
+	flags.StringSlice("plant-name", nil, "Plant name to use (case insensitive), may be repeated or comma separated")
+	flags.Bool("all-plants", false, "Use every plant of the account")
+}
+
+func plantSelectorFromFlags(cmd *cobra.Command) PlantSelector {
+
+	var sel PlantSelector
+
+	sel.IDs, _ = cmd.Flags().GetStringSlice("plant-id")
+	sel.Names, _ = cmd.Flags().GetStringSlice("plant-name")
+	sel.All, _ = cmd.Flags().GetBool("all-plants")
+
+	return sel
+}
+
+// Empty reports whether no selection flags were given.
+func (sel PlantSelector) Empty() bool {
+	return len(sel.IDs) == 0 && len(sel.Names) == 0 && !sel.All
+}
+
+// Filter returns the plants matching the selection, in their original order.
+func (sel PlantSelector) Filter(plants []sunsynk.SSApiUserPlant) []sunsynk.SSApiUserPlant {
+
+	if sel.All || (len(sel.IDs) == 0 && len(sel.Names) == 0) {
+		return plants
+	}
+
+	var selected []sunsynk.SSApiUserPlant
+
+	for _, plant := range plants {
+		if sel.matches(plant) {
+			selected = append(selected, plant)
+		}
+	}
+
+	return selected
+}
+
+func (sel PlantSelector) matches(plant sunsynk.SSApiUserPlant) bool {
+
+	for _, id := range sel.IDs {
+		if id == strconv.Itoa(plant.Id) {
+			return true
+		}
+	}
+
+	for _, name := range sel.Names {
+		if strings.EqualFold(name, plant.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetPlants resolves the selection to a list of plants. The plant list comes
+// from the account's plants secret in Kubernetes mode and from
+// the API otherwise; selecting plants by ID alone does not need the list,
+// unless there are several accounts to tell the plant's one from.
+func GetPlants(ctx context.Context, client *sunsynk.Client, account Account, k8s bool, sel PlantSelector) []sunsynk.SSApiUserPlant {
+
+	sel = account.selector(sel)
+
+	if !k8s && len(sel.Names) == 0 && !sel.All && len(accounts) == 1 {
+
+		ids := sel.IDs
+		if len(ids) == 0 && account.Name == "" {
+			if SunsynkPlantId := os.Getenv("SS_PLANT_ID"); SunsynkPlantId != "" {
+				ids = strings.Split(SunsynkPlantId, ",")
+			}
+		}
+
+		if len(ids) == 0 {
+			log.Fatal("No plant ID found in env")
+		}
+
+		var plants []sunsynk.SSApiUserPlant
+		for _, id := range ids {
+			plantId, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				log.Fatalf("Invalid plant ID %q", id)
+			}
+			plants = append(plants, sunsynk.SSApiUserPlant{Id: plantId})
+		}
+
+		return plants
+	}
+
+	var plants []sunsynk.SSApiUserPlant
+
+	if k8s {
+		plants = GetStoredPlants(ctx, account)
+	} else {
+		userdata, err := client.GetUserPlants(ctx)
+		if err != nil {
+			FatalAPIError(err)
+		}
+		plants = userdata.Data.Infos
+	}
+
+	// With several accounts a selection usually matches the plants of only
+	// some of them.
+	selected := sel.Filter(plants)
+	if len(selected) == 0 && len(accounts) > 1 {
+		log.Warnf("No plants of account %s match the selection", account)
+	} else if len(selected) == 0 {
+		log.Fatal("No plants match the selection")
+	}
+
+	return selected
+}
+
+// GetStoredPlants reads the plant list of account saved by
+// `ssctl user --k8s`.
+func GetStoredPlants(ctx context.Context, account Account) []sunsynk.SSApiUserPlant {
+
+	store := kubeStore(account)
+
+	var UserPlantsStruct []sunsynk.SSApiUserPlant
+
+	if err := store.GetJSON(ctx, store.Names.Plants, "plants.json", &UserPlantsStruct); err != nil {
+		log.Fatal(err)
+	}
+
+	return UserPlantsStruct
+}
@@ -1,14 +1,31 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var Version = "dev"
 
+// requestTimeout bounds every individual HTTP request, cancelTimeout
+// releases the overall --timeout deadline once the command has finished and
+// pageSize is used when listing plants and inverters.
+var (
+	requestTimeout                    = 30 * time.Second
+	cancelTimeout  context.CancelFunc = func() {}
+	pageSize                          = sunsynk.DefaultPageSize
+)
+
 // rootCmd represents the base command when called without any subcommands
 // var rootCmd = &cobra.Command{
 // 	Use:   "ssctl",
@@ -46,13 +63,71 @@ var rootCmd = &cobra.Command{
      • Query inverter, battery, and plant data
      • Scriptable and automation-friendly
 
+   Configuration:
+     Settings are taken from flags, then environment variables, then the
+     selected profile of the config file (--config, --profile), then the
+     defaults.
+
+   Accounts:
+     A profile may list several Sunsynk accounts, each with its own login,
+     token and plants. Commands work on every account, or the ones given
+     with --account, and label their results with the account name.
+
+   Stores:
+     Credentials are read from the environment, a local file, Kubernetes
+     secrets or HashiCorp Vault and tokens kept in a local cache, Kubernetes
+     secrets or Vault, as chosen with --credential-store and --token-store.
+
 `, Version),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		if err := applyConfig(cmd); err != nil {
+			log.Fatal(err)
+		}
+
+		kubeSettingsFromFlags(cmd)
+
+		if err := storeSettingsFromFlags(cmd); err != nil {
+			log.Fatal(err)
+		}
+
+		accountNames, _ := cmd.Flags().GetStringSlice("account")
+		k8s, _ := cmd.Flags().GetBool("k8s")
+
+		selected, err := selectAccounts(configAccounts, accountNames, k8s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		accounts = selected
+
+		pageSize, _ = cmd.Flags().GetInt("page-size")
+
+		requestTimeout, _ = cmd.Flags().GetDuration("request-timeout")
+
+		utils.Retry.MaxAttempts, _ = cmd.Flags().GetInt("retry-attempts")
+		utils.Retry.InitialBackoff, _ = cmd.Flags().GetDuration("retry-backoff")
+		utils.Retry.MaxBackoff, _ = cmd.Flags().GetDuration("retry-max-backoff")
+		utils.Retry.Jitter, _ = cmd.Flags().GetFloat64("retry-jitter")
+
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			cmd.SetContext(ctx)
+			cancelTimeout = cancel
+		}
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// SIGINT and SIGTERM cancel the command context so that Kubernetes job
+// termination aborts any in-flight requests.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
+	cancelTimeout()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -63,11 +138,23 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.ssctl.yaml)")
+	rootCmd.PersistentFlags().String("config", "", "Config file, also $SSCTL_CONFIG (default: $XDG_CONFIG_HOME/ssctl/config.yaml)")
+	rootCmd.PersistentFlags().String("profile", "", "Profile of the config file to use, also $SSCTL_PROFILE (default: its currentProfile, else \"default\")")
 
+	rootCmd.PersistentFlags().StringSlice("account", nil, "Account of the config profile to use, may be repeated or comma separated (default: every account)")
 	rootCmd.PersistentFlags().Bool("k8s", false, "Use Kubernetes secrets to read and store credentials")
+	addKubeFlags(rootCmd.PersistentFlags())
+	addStoreFlags(rootCmd.PersistentFlags())
 	rootCmd.PersistentFlags().Bool("upload", false, "Upload to influxdb")
 	rootCmd.PersistentFlags().Bool("debug", false, "Enable debug logging")
+	rootCmd.PersistentFlags().StringP("output", "o", "", "Output format: json, ndjson, csv, table, yaml or line (default depends on the command)")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Overall deadline for the command, e.g. 2m (0 disables)")
+	rootCmd.PersistentFlags().Duration("request-timeout", 30*time.Second, "Deadline for each individual HTTP request")
+	rootCmd.PersistentFlags().Int("page-size", sunsynk.DefaultPageSize, "Number of plants or inverters fetched per page when listing")
+	rootCmd.PersistentFlags().Int("retry-attempts", utils.DefaultRetryPolicy.MaxAttempts, "Maximum attempts for requests failing with 429, 5xx or connection errors")
+	rootCmd.PersistentFlags().Duration("retry-backoff", utils.DefaultRetryPolicy.InitialBackoff, "Initial backoff between retries, doubled on each attempt")
+	rootCmd.PersistentFlags().Duration("retry-max-backoff", utils.DefaultRetryPolicy.MaxBackoff, "Upper bound for the backoff between retries")
+	rootCmd.PersistentFlags().Float64("retry-jitter", utils.DefaultRetryPolicy.Jitter, "Randomise each backoff by +/- this fraction")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
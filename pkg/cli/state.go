@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultStatePath returns name in the ssctl directory under
+// $XDG_STATE_HOME (falling back to ~/.local/state).
+func defaultStatePath(name string) (string, error) {
+
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(stateHome, "ssctl", name), nil
+}
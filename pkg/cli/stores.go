@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"ssctl/pkg/credstore"
+	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/vault"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// The backends of --credential-store and --token-store.
+const (
+	StoreEnv        = "env"
+	StoreFile       = "file"
+	StoreKubernetes = "kubernetes"
+	StoreVault      = "vault"
+)
+
+// credentialBackend and tokenBackend are the stores selected with the flags
+// or environment, set before any command runs. Empty selects the default of
+// the mode: Kubernetes secrets with --k8s, otherwise the environment or
+// config for credentials and the local token cache for tokens. vaultClient
+// is created on first use.
+var (
+	credentialBackend string
+	tokenBackend      string
+	vaultClient       *vault.Client
+)
+
+func addStoreFlags(flags *pflag.FlagSet) {
+	flags.String("credential-store", "", "Where the username and password are read from: env, file, kubernetes or vault, also $SS_CREDENTIAL_STORE")
+	flags.String("token-store", "", "Where the token is kept: file, kubernetes or vault, also $SS_TOKEN_STORE")
+}
+
+// storeSettingsFromFlags selects the stores from the flags, falling back to
+// the environment.
+func storeSettingsFromFlags(cmd *cobra.Command) error {
+
+	setting := func(flag, env string) string {
+		if value, _ := cmd.Flags().GetString(flag); value != "" {
+			return value
+		}
+		return os.Getenv(env)
+	}
+
+	credentialBackend = setting("credential-store", "SS_CREDENTIAL_STORE")
+	tokenBackend = setting("token-store", "SS_TOKEN_STORE")
+
+	switch credentialBackend {
+	case "", StoreEnv, StoreFile, StoreKubernetes, StoreVault:
+	default:
+		return fmt.Errorf("invalid credential store %q, expected env, file, kubernetes or vault", credentialBackend)
+	}
+
+	switch tokenBackend {
+	case "", StoreFile, StoreKubernetes, StoreVault:
+	default:
+		return fmt.Errorf("invalid token store %q, expected file, kubernetes or vault", tokenBackend)
+	}
+
+	return nil
+}
+
+// credentialStore returns the store the login of account is read from. The
+// env store reads SS_USER and SS_PASS for the default account and the user
+// and password of the config profile for named ones.
+func credentialStore(account Account, k8s bool) sunsynk.CredentialStore {
+
+	backend := credentialBackend
+	if backend == "" {
+		backend = StoreEnv
+		if k8s {
+			backend = StoreKubernetes
+		}
+	}
+
+	switch backend {
+	case StoreFile:
+		path, err := credstore.DefaultFilePath(account.Name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return credstore.File{Path: path}
+	case StoreKubernetes:
+		return kubeStore(account)
+	case StoreVault:
+		return vaultStore(account)
+	}
+
+	if account.Name == "" {
+		return credstore.DefaultEnv
+	}
+
+	return credstore.Static{
+		User:     account.User,
+		Password: account.Password,
+		Source:   fmt.Sprintf("account %q", account.Name),
+	}
+}
+
+// tokenStore returns the store the token of account is kept in.
+func tokenStore(account Account, k8s bool) sunsynk.TokenStore {
+
+	backend := tokenBackend
+	if backend == "" {
+		backend = StoreFile
+		if k8s {
+			backend = StoreKubernetes
+		}
+	}
+
+	switch backend {
+	case StoreKubernetes:
+		return kubeStore(account)
+	case StoreVault:
+		return vaultStore(account)
+	}
+
+	return account.tokenCache()
+}
+
+// vaultStore returns the Vault store of account, under the account name
+// below $SS_VAULT_PATH for named accounts.
+func vaultStore(account Account) *vault.Store {
+
+	if vaultClient == nil {
+		vaultClient = NewVaultClient()
+	}
+
+	mount := os.Getenv("SS_VAULT_MOUNT")
+	if mount == "" {
+		mount = vault.DefaultMount
+	}
+
+	base := os.Getenv("SS_VAULT_PATH")
+	if base == "" {
+		base = vault.DefaultPath
+	}
+
+	return &vault.Store{
+		Client: vaultClient,
+		Mount:  mount,
+		Path:   path.Join(base, account.Name),
+	}
+}
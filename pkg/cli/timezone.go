@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PlantLocation returns the timezone the plant reports its chart times in.
+// An IANA zone given with --tz wins over the plant's own metadata; when
+// neither is usable UTC is assumed.
+func PlantLocation(ctx context.Context, client *sunsynk.Client, plantId int, tz string) *time.Location {
+
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Fatalf("Invalid timezone %q: %v", tz, err)
+		}
+		return loc
+	}
+
+	info, err := client.GetPlantInfo(ctx, strconv.Itoa(plantId))
+	if err != nil {
+		log.Warnf("Could not read timezone of plant %d, assuming UTC: %v", plantId, err)
+		return time.UTC
+	}
+
+	code := info.Data.Timezone.Code
+	if code == "" {
+		log.Warnf("Plant %d has no timezone set, assuming UTC", plantId)
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(code)
+	if err != nil {
+		log.Warnf("Unknown timezone %q for plant %d, assuming UTC", code, plantId)
+		return time.UTC
+	}
+
+	return loc
+}
+
+// wallClock converts a series of local wall-clock times into instants. Around
+// DST changes a wall-clock time can be skipped (clocks go forward) or occur
+// twice (clocks go back). Skipped times cannot be placed and are dropped;
+// repeated times are told apart by assuming the series is chronological, so
+// the second 01:30 of the day is placed after the first.
+type wallClock struct {
+	loc  *time.Location
+	last time.Time
+	// days is how far resolveSeries has moved on from its start date.
+	days int
+}
+
+func newWallClock(loc *time.Location) *wallClock {
+	return &wallClock{loc: loc}
+}
+
+// resolve returns the instant of hh:mm on date. ok is false when that time
+// does not exist in the location.
+func (w *wallClock) resolve(date, hhmm string) (t time.Time, ok bool, err error) {
+
+	wall, err := time.Parse("2006-01-02 15:04", date+" "+hhmm)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid time %q on %s: %w", hhmm, date, err)
+	}
+
+	t, ok = w.place(wall)
+
+	return t, ok, nil
+}
+
+// resolveSeries is resolve for a series that starts on date and may run
+// over several days, with times given as hh:mm or hh:mm:ss. When a time can
+// only be placed before the previous one the series has moved on to the next
+// day.
+func (w *wallClock) resolveSeries(date, clock string) (t time.Time, ok bool, err error) {
+
+	layout := "2006-01-02 15:04"
+	if len(clock) == len("15:04:05") {
+		layout += ":05"
+	}
+
+	wall, err := time.Parse(layout, date+" "+clock)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid time %q on %s: %w", clock, date, err)
+	}
+	wall = wall.AddDate(0, 0, w.days)
+
+	candidates := w.candidates(wall)
+	if len(candidates) > 0 && candidates[len(candidates)-1].Before(w.last) {
+		w.days++
+		wall = wall.AddDate(0, 0, 1)
+	}
+
+	t, ok = w.place(wall)
+
+	return t, ok, nil
+}
+
+// place returns the instant showing wall (read as UTC) in the location,
+// the first one after the previous time when it occurs twice. ok is false
+// when wall does not exist in the location.
+func (w *wallClock) place(wall time.Time) (t time.Time, ok bool) {
+
+	candidates := w.candidates(wall)
+	if len(candidates) == 0 {
+		return time.Time{}, false
+	}
+
+	t = candidates[len(candidates)-1]
+	for _, c := range candidates {
+		if c.After(w.last) {
+			t = c
+			break
+		}
+	}
+
+	w.last = t
+
+	return t, true
+}
+
+// candidates returns, in order, every instant that shows the wall-clock time
+// of wall (read as UTC) in the location. Offsets in effect a day either side
+// cover any transition the time could fall into.
+func (w *wallClock) candidates(wall time.Time) []time.Time {
+
+	offsets := map[int]bool{}
+	for _, probe := range []time.Time{wall.Add(-24 * time.Hour), wall, wall.Add(24 * time.Hour)} {
+		_, offset := probe.In(w.loc).Zone()
+		offsets[offset] = true
+	}
+
+	var candidates []time.Time
+	for offset := range offsets {
+		t := wall.Add(-time.Duration(offset) * time.Second)
+		local := t.In(w.loc)
+		if local.Year() == wall.Year() && local.YearDay() == wall.YearDay() &&
+			local.Hour() == wall.Hour() && local.Minute() == wall.Minute() {
+			candidates = append(candidates, t)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+
+	return candidates
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWallClock(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		zone  string
+		date  string
+		times []string
+		// want holds the UTC instants, "" where the time does not exist.
+		want []string
+	}{
+		{
+			name:  "no transition",
+			zone:  "Africa/Johannesburg",
+			date:  "2024-06-01",
+			times: []string{"00:00", "12:30", "23:55"},
+			want:  []string{"2024-05-31T22:00:00Z", "2024-06-01T10:30:00Z", "2024-06-01T21:55:00Z"},
+		},
+		{
+			name:  "gap when clocks go forward",
+			zone:  "Europe/London",
+			date:  "2024-03-31",
+			times: []string{"00:55", "01:00", "01:30", "02:00"},
+			want:  []string{"2024-03-31T00:55:00Z", "", "", "2024-03-31T01:00:00Z"},
+		},
+		{
+			name:  "overlap when clocks go back",
+			zone:  "Europe/London",
+			date:  "2024-10-27",
+			times: []string{"00:30", "01:00", "01:30", "01:00", "01:30", "02:00"},
+			want: []string{
+				"2024-10-26T23:30:00Z",
+				"2024-10-27T00:00:00Z",
+				"2024-10-27T00:30:00Z",
+				"2024-10-27T01:00:00Z",
+				"2024-10-27T01:30:00Z",
+				"2024-10-27T02:00:00Z",
+			},
+		},
+		{
+			name:  "overlap seen once",
+			zone:  "Europe/London",
+			date:  "2024-10-27",
+			times: []string{"00:00", "01:30", "03:00"},
+			want:  []string{"2024-10-26T23:00:00Z", "2024-10-27T00:30:00Z", "2024-10-27T03:00:00Z"},
+		},
+		{
+			name:  "southern hemisphere gap",
+			zone:  "Australia/Sydney",
+			date:  "2024-10-06",
+			times: []string{"01:30", "02:30", "03:30"},
+			want:  []string{"2024-10-05T15:30:00Z", "", "2024-10-05T16:30:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clock := newWallClock(loc)
+
+			for i, hhmm := range tt.times {
+
+				got, ok, err := clock.resolve(tt.date, hhmm)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if tt.want[i] == "" {
+					if ok {
+						t.Errorf("%s resolved to %s, want skipped", hhmm, got.UTC().Format(time.RFC3339))
+					}
+					continue
+				}
+				if !ok {
+					t.Errorf("%s skipped, want %s", hhmm, tt.want[i])
+					continue
+				}
+				if s := got.UTC().Format(time.RFC3339); s != tt.want[i] {
+					t.Errorf("%s = %s, want %s", hhmm, s, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWallClockInvalidTime(t *testing.T) {
+
+	if _, _, err := newWallClock(time.UTC).resolve("2024-01-01", "25:00"); err == nil {
+		t.Error("resolve of 25:00 did not fail")
+	}
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"os"
+
+	"ssctl/pkg/credstore"
+	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/tokencache"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// newTokenCache returns the local token cache, encrypted when
+// SS_TOKEN_PASSPHRASE is set.
+func newTokenCache() tokencache.FileStore {
+
+	path, err := tokencache.DefaultPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return tokencache.FileStore{
+		Path:       path,
+		Passphrase: os.Getenv("SS_TOKEN_PASSPHRASE"),
+	}
+}
+
+// NewTokenSource returns a token source for account backed by its credential
+// and token stores. Outside Kubernetes mode a token given with SS_TOKEN and
+// SS_REFRESH_TOKEN, or in the config of a named account, is used until a
+// newer one has been stored. Tokens are refreshed before they expire and, as
+// a last resort, renewed with a full password login.
+func NewTokenSource(client *sunsynk.Client, account Account, k8s bool) *sunsynk.RefreshingTokenSource {
+
+	source := &sunsynk.RefreshingTokenSource{
+		Client:      client,
+		Store:       tokenStore(account, k8s),
+		Credentials: credentialStore(account, k8s),
+	}
+
+	if !k8s {
+		token := sunsynk.SSAuthToken{AccessToken: account.Token, RefreshToken: account.RefreshToken}
+		if account.Name == "" {
+			token.AccessToken = os.Getenv("SS_TOKEN")
+			token.RefreshToken = os.Getenv("SS_REFRESH_TOKEN")
+		}
+		source.Store = credstore.Preset{Token: token, Store: source.Store}
+	}
+
+	return source
+}
@@ -1,12 +1,11 @@
 package cli
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"log"
 	"os"
-	"ssctl/pkg/kube"
 	"ssctl/pkg/sunsynk"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -30,12 +29,14 @@ to quickly create a Cobra application.`,
 		}
 
 		k8sFlagValue, _ := cmd.Parent().PersistentFlags().GetBool("k8s")
-		User(k8sFlagValue)
+		format := outputFormatFromFlags(cmd, OutputJSON)
+		User(cmd.Context(), k8sFlagValue, plantSelectorFromFlags(cmd), format)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(userCmd)
+	addPlantSelectorFlags(userCmd.Flags())
 
 	// Here you will define your flags and configuration settings.
 
@@ -48,68 +49,62 @@ func init() {
 	// userCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-func User(k8s bool) {
+// AccountPlant is a plant of the account it was listed from.
+type AccountPlant struct {
+	Account string `json:"account,omitempty"`
+	sunsynk.SSApiUserPlant
+}
+
+// User prints the plants of each account, limited to the selected ones. In
+// Kubernetes mode the list is stored in the account's plants secret for the
+// plant and inverter commands instead.
+func User(ctx context.Context, k8s bool, sel PlantSelector, format OutputFormat) {
 
 	if !k8s {
 
-		SunsynkToken := os.Getenv("SS_TOKEN")
+		var plants []AccountPlant
 
-		if SunsynkToken == "" {
-			log.Fatal("No token found in env 4")
-		}
+		for _, account := range accounts {
+
+			userdata, err := NewAuthenticatedClient(account, k8s).GetUserPlants(ctx)
+			if err != nil {
+				FatalAPIError(err)
+			}
 
-		userdata, err := sunsynk.GetUserData(sunsynk.SSApiListPlantsEndpoint, SunsynkToken)
-		if err != nil {
-			log.Fatal(err)
+			for _, plant := range account.selector(sel).Filter(userdata.Data.Infos) {
+				plants = append(plants, AccountPlant{Account: account.Name, SSApiUserPlant: plant})
+			}
 		}
 
-		fmt.Println(string(userdata))
+		printOutput(format, plants, userTable)
 
 	} else {
 
-		clientset, err := kube.Login()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		result, err := kube.GetK8sSecret(clientset, "sunsynk-token", "sunsynk")
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		token, ok := result.Data["token"]
-		if !ok {
-			log.Fatal("token not found in secret data")
-		}
+		for _, account := range accounts {
 
-		userdata, err := sunsynk.GetUserData(sunsynk.SSApiListPlantsEndpoint, string(token))
-		if err != nil {
-			log.Fatal(err)
-		}
+			userdatastruct, err := NewAuthenticatedClient(account, k8s).GetUserPlants(ctx)
+			if err != nil {
+				FatalAPIError(err)
+			}
 
-		var userdatastruct sunsynk.SSApiUserPlantsResponse
+			userdatastruct.Data.Infos = account.selector(sel).Filter(userdatastruct.Data.Infos)
 
-		err = json.Unmarshal(userdata, &userdatastruct)
-		if err != nil {
-			log.Fatal(err)
-		}
+			store := kubeStore(account)
 
-		result, err = kube.GetK8sSecret(clientset, "sunsynk-user-plants", "sunsynk")
-		if err != nil {
-			//Create the secret
-			result, err = kube.CreateK8sSecret(clientset, "sunsynk-user-plants", "sunsynk", userdatastruct.Data.Infos, "plants.json")
-			if err != nil {
+			if err := store.PutJSON(ctx, store.Names.Plants, "plants.json", userdatastruct.Data.Infos); err != nil {
 				log.Fatal(err)
 			}
-			log.Printf("Created secret %q\n", result.GetObjectMeta().GetName())
-		} else {
-			result, err = kube.UpdateK8sSecret(clientset, result, "sunsynk", userdatastruct.Data.Infos, "plants.json")
-			if err != nil {
-				log.Fatal(err)
-			}
-			log.Printf("Updated secret %q\n", result.GetObjectMeta().GetName())
 		}
 
 	}
 
 }
+
+// userTable lays plants out for the csv and table outputs.
+var userTable = outputTable[AccountPlant]{
+	columns: []string{"id", "name"},
+	row: func(p AccountPlant) []string {
+		return []string{strconv.Itoa(p.Id), p.Name}
+	},
+	account: func(p AccountPlant) string { return p.Account },
+}
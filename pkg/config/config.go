@@ -0,0 +1,289 @@
+// Package config reads the ssctl configuration file: named profiles, each
+// holding the account, API endpoint, plant selection, sinks and Kubernetes
+// settings of one Sunsynk installation.
+//
+// A profile only fills in what is not given otherwise. Settings are taken
+// from, in order of precedence: command line flags, environment variables,
+// the selected profile and the built-in defaults.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultProfile is used when neither --profile nor currentProfile pick one.
+const DefaultProfile = "default"
+
+// Config is the content of the configuration file.
+type Config struct {
+	// CurrentProfile is the profile used when none is given with --profile.
+	CurrentProfile string             `json:"currentProfile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles,omitempty"`
+}
+
+// Profile is one named set of settings. Account is the single login used
+// when Accounts, the list of logins each with their own plants, is empty.
+type Profile struct {
+	Account    Account        `json:"account,omitempty"`
+	Accounts   []NamedAccount `json:"accounts,omitempty"`
+	Endpoint   string         `json:"endpoint,omitempty"`
+	Plants     Plants         `json:"plants,omitempty"`
+	Timezone   string         `json:"timezone,omitempty"`
+	Output     string         `json:"output,omitempty"`
+	Upload     *bool          `json:"upload,omitempty"`
+	Debug      *bool          `json:"debug,omitempty"`
+	InfluxDB   InfluxDB       `json:"influxdb,omitempty"`
+	Kubernetes Kubernetes     `json:"kubernetes,omitempty"`
+	Stores     Stores         `json:"stores,omitempty"`
+}
+
+// Account holds the Sunsynk credentials and token settings.
+type Account struct {
+	User            string `json:"user,omitempty"`
+	Password        string `json:"password,omitempty"`
+	Token           string `json:"token,omitempty"`
+	RefreshToken    string `json:"refreshToken,omitempty"`
+	TokenCache      string `json:"tokenCache,omitempty"`
+	TokenPassphrase string `json:"tokenPassphrase,omitempty"`
+}
+
+// NamedAccount is one of several Sunsynk logins of a profile. The name is
+// the account label of every reading and part of the names of its token
+// cache and Kubernetes secrets.
+type NamedAccount struct {
+	Name string `json:"name"`
+	Account
+	Plants Plants `json:"plants,omitempty"`
+}
+
+// Plants selects the plants commands work on, like the --plant-id,
+// --plant-name and --all-plants flags.
+type Plants struct {
+	IDs   []string `json:"ids,omitempty"`
+	Names []string `json:"names,omitempty"`
+	All   bool     `json:"all,omitempty"`
+}
+
+// InfluxDB holds the InfluxDB sink settings, see the INFLUXDB_* variables.
+type InfluxDB struct {
+	URL             string `json:"url,omitempty"`
+	Version         int    `json:"version,omitempty"`
+	Org             string `json:"org,omitempty"`
+	Bucket          string `json:"bucket,omitempty"`
+	Token           string `json:"token,omitempty"`
+	Database        string `json:"database,omitempty"`
+	RetentionPolicy string `json:"retentionPolicy,omitempty"`
+	Username        string `json:"username,omitempty"`
+	Password        string `json:"password,omitempty"`
+	Precision       string `json:"precision,omitempty"`
+	Gzip            *bool  `json:"gzip,omitempty"`
+}
+
+// Kubernetes holds the settings of --k8s mode.
+type Kubernetes struct {
+	// Enabled turns --k8s on by default.
+	Enabled    *bool   `json:"enabled,omitempty"`
+	Namespace  string  `json:"namespace,omitempty"`
+	Kubeconfig string  `json:"kubeconfig,omitempty"`
+	Secrets    Secrets `json:"secrets,omitempty"`
+}
+
+// Secrets names the secrets of --k8s mode, like the --credentials-secret,
+// --token-secret and --plants-secret flags.
+type Secrets struct {
+	Credentials string `json:"credentials,omitempty"`
+	Token       string `json:"token,omitempty"`
+	Plants      string `json:"plants,omitempty"`
+}
+
+// Stores selects where the credentials and tokens are kept, like the
+// --credential-store and --token-store flags.
+type Stores struct {
+	// Credentials is env, file, kubernetes or vault.
+	Credentials string `json:"credentials,omitempty"`
+	// Tokens is file, kubernetes or vault.
+	Tokens          string `json:"tokens,omitempty"`
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	Vault           Vault  `json:"vault,omitempty"`
+}
+
+// Vault holds the HashiCorp Vault settings of the vault stores, see the
+// VAULT_* and SS_VAULT_* variables.
+type Vault struct {
+	Address   string `json:"address,omitempty"`
+	Token     string `json:"token,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Mount     string `json:"mount,omitempty"`
+	Path      string `json:"path,omitempty"`
+}
+
+// Dir returns the ssctl directory under $XDG_CONFIG_HOME (falling back to
+// ~/.config).
+func Dir() (string, error) {
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configHome, "ssctl"), nil
+}
+
+// DefaultPath returns config.yaml in the ssctl directory.
+func DefaultPath() (string, error) {
+
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Load reads the configuration file at path. A missing file is an empty
+// configuration unless required is set.
+func Load(path string, required bool) (*Config, error) {
+
+	cfg := &Config{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	for name, profile := range cfg.Profiles {
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("config %s: profile %q: %w", path, name, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// Profile returns the named profile, or when name is empty the current
+// profile, falling back to the "default" one. Without a current or default
+// profile the empty profile is returned, so that a missing configuration
+// file changes nothing.
+func (c *Config) Profile(name string) (Profile, error) {
+
+	if name == "" {
+		name = c.CurrentProfile
+	}
+	if name == "" {
+		return c.Profiles[DefaultProfile], nil
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q not found, known profiles: %s", name, strings.Join(c.Names(), ", "))
+	}
+
+	return profile, nil
+}
+
+// accountName is what account names are limited to, as they end up in
+// Kubernetes secret names.
+var accountName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+func (p Profile) validate() error {
+
+	seen := map[string]bool{}
+
+	for _, account := range p.Accounts {
+		if !accountName.MatchString(account.Name) {
+			return fmt.Errorf("invalid account name %q, use lower case letters, digits and dashes", account.Name)
+		}
+		if seen[account.Name] {
+			return fmt.Errorf("account %q is listed twice", account.Name)
+		}
+		seen[account.Name] = true
+	}
+
+	return nil
+}
+
+// Names returns the profile names in order.
+func (c *Config) Names() []string {
+
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Env returns the environment variables the profile sets, for the settings
+// that are read from the environment.
+func (p Profile) Env() map[string]string {
+
+	env := map[string]string{}
+
+	set := func(key, value string) {
+		if value != "" {
+			env[key] = value
+		}
+	}
+
+	set("SS_USER", p.Account.User)
+	set("SS_PASS", p.Account.Password)
+	set("SS_TOKEN", p.Account.Token)
+	set("SS_REFRESH_TOKEN", p.Account.RefreshToken)
+	set("SS_TOKEN_CACHE", p.Account.TokenCache)
+	set("SS_TOKEN_PASSPHRASE", p.Account.TokenPassphrase)
+	set("SS_API_ENDPOINT", p.Endpoint)
+
+	set("INFLUXDB_URL", p.InfluxDB.URL)
+	if p.InfluxDB.Version != 0 {
+		set("INFLUXDB_VERSION", strconv.Itoa(p.InfluxDB.Version))
+	}
+	set("INFLUXDB_ORG", p.InfluxDB.Org)
+	set("INFLUXDB_BUCKET", p.InfluxDB.Bucket)
+	set("INFLUXDB_TOKEN", p.InfluxDB.Token)
+	set("INFLUXDB_DB", p.InfluxDB.Database)
+	set("INFLUXDB_RP", p.InfluxDB.RetentionPolicy)
+	set("INFLUXDB_USERNAME", p.InfluxDB.Username)
+	set("INFLUXDB_PASSWORD", p.InfluxDB.Password)
+	set("INFLUXDB_PRECISION", p.InfluxDB.Precision)
+	if p.InfluxDB.Gzip != nil {
+		set("INFLUXDB_GZIP", strconv.FormatBool(*p.InfluxDB.Gzip))
+	}
+
+	set("SS_NAMESPACE", p.Kubernetes.Namespace)
+	set("KUBECONFIG", p.Kubernetes.Kubeconfig)
+	set("SS_CREDENTIALS_SECRET", p.Kubernetes.Secrets.Credentials)
+	set("SS_TOKEN_SECRET", p.Kubernetes.Secrets.Token)
+	set("SS_PLANTS_SECRET", p.Kubernetes.Secrets.Plants)
+
+	set("SS_CREDENTIAL_STORE", p.Stores.Credentials)
+	set("SS_TOKEN_STORE", p.Stores.Tokens)
+	set("SS_CREDENTIALS_FILE", p.Stores.CredentialsFile)
+	set("VAULT_ADDR", p.Stores.Vault.Address)
+	set("VAULT_TOKEN", p.Stores.Vault.Token)
+	set("VAULT_NAMESPACE", p.Stores.Vault.Namespace)
+	set("SS_VAULT_MOUNT", p.Stores.Vault.Mount)
+	set("SS_VAULT_PATH", p.Stores.Vault.Path)
+
+	return env
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "empty", content: ""},
+		{name: "profiles", content: "currentProfile: home\nprofiles:\n  home:\n    endpoint: https://example.com\n"},
+		{name: "accounts", content: "profiles:\n  default:\n    accounts:\n    - name: acme\n    - name: beta-2\n"},
+		{name: "unknown field", content: "profiles:\n  default:\n    endpiont: https://example.com\n", wantErr: true},
+		{name: "not yaml", content: "profiles: [", wantErr: true},
+		{name: "upper case account", content: "profiles:\n  default:\n    accounts:\n    - name: Acme\n", wantErr: true},
+		{name: "account with slash", content: "profiles:\n  default:\n    accounts:\n    - name: acme/beta\n", wantErr: true},
+		{name: "account without name", content: "profiles:\n  default:\n    accounts:\n    - user: someone\n", wantErr: true},
+		{name: "duplicate account", content: "profiles:\n  default:\n    accounts:\n    - name: acme\n    - name: acme\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			_, err := Load(writeConfig(t, tt.content), true)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	cfg, err := Load(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Profiles) != 0 {
+		t.Errorf("profiles = %v, want none", cfg.Profiles)
+	}
+
+	if _, err := Load(path, true); err == nil {
+		t.Error("loading a missing required config did not fail")
+	}
+}
+
+func TestProfile(t *testing.T) {
+
+	profiles := map[string]Profile{
+		"default": {Endpoint: "default"},
+		"home":    {Endpoint: "home"},
+		"work":    {Endpoint: "work"},
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		profile string
+		want    string
+		wantErr bool
+	}{
+		{name: "named", config: Config{CurrentProfile: "home", Profiles: profiles}, profile: "work", want: "work"},
+		{name: "current", config: Config{CurrentProfile: "home", Profiles: profiles}, want: "home"},
+		{name: "default", config: Config{Profiles: profiles}, want: "default"},
+		{name: "no default", config: Config{Profiles: map[string]Profile{"home": {Endpoint: "home"}}}, want: ""},
+		{name: "empty config", config: Config{}, want: ""},
+		{name: "unknown named", config: Config{Profiles: profiles}, profile: "garden", wantErr: true},
+		{name: "unknown current", config: Config{CurrentProfile: "garden", Profiles: profiles}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			profile, err := tt.config.Profile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if profile.Endpoint != tt.want {
+				t.Errorf("profile endpoint = %q, want %q", profile.Endpoint, tt.want)
+			}
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+
+	cfg := Config{Profiles: map[string]Profile{"work": {}, "default": {}, "home": {}}}
+
+	if got, want := cfg.Names(), []string{"default", "home", "work"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names = %v, want %v", got, want)
+	}
+}
+
+func TestEnv(t *testing.T) {
+
+	gzip := false
+
+	profile := Profile{
+		Account:  Account{User: "user", Password: "pass", TokenPassphrase: "secret"},
+		Endpoint: "https://api.example.com",
+		Timezone: "Europe/London",
+		InfluxDB: InfluxDB{URL: "http://influx:8086", Version: 2, Org: "home", Bucket: "solar", Gzip: &gzip},
+		Kubernetes: Kubernetes{
+			Namespace: "solar",
+			Secrets:   Secrets{Token: "token"},
+		},
+		Stores: Stores{Tokens: "vault", Vault: Vault{Address: "http://vault:8200", Path: "solar"}},
+	}
+
+	want := map[string]string{
+		"SS_USER":             "user",
+		"SS_PASS":             "pass",
+		"SS_TOKEN_PASSPHRASE": "secret",
+		"SS_API_ENDPOINT":     "https://api.example.com",
+		"INFLUXDB_URL":        "http://influx:8086",
+		"INFLUXDB_VERSION":    "2",
+		"INFLUXDB_ORG":        "home",
+		"INFLUXDB_BUCKET":     "solar",
+		"INFLUXDB_GZIP":       "false",
+		"SS_NAMESPACE":        "solar",
+		"SS_TOKEN_SECRET":     "token",
+		"SS_TOKEN_STORE":      "vault",
+		"VAULT_ADDR":          "http://vault:8200",
+		"SS_VAULT_PATH":       "solar",
+	}
+
+	if got := profile.Env(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Env =\n%v\nwant\n%v", got, want)
+	}
+
+	if got := (Profile{}).Env(); len(got) != 0 {
+		t.Errorf("Env of the empty profile = %v, want none", got)
+	}
+}
@@ -0,0 +1,163 @@
+// Package credstore holds the credential and token stores that do not need a
+// server: the environment, the config file and local files. The Kubernetes
+// and Vault stores live in the kube and vault packages, and the local token
+// cache in tokencache.
+package credstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ssctl/pkg/config"
+	"ssctl/pkg/sunsynk"
+)
+
+// Env reads the username and password from the named environment variables
+// each time they are needed.
+type Env struct {
+	UserVar     string
+	PasswordVar string
+}
+
+// DefaultEnv reads SS_USER and SS_PASS.
+var DefaultEnv = Env{UserVar: "SS_USER", PasswordVar: "SS_PASS"}
+
+func (e Env) Credentials(ctx context.Context) (string, string, error) {
+
+	user := os.Getenv(e.UserVar)
+	pass := os.Getenv(e.PasswordVar)
+
+	if user == "" || pass == "" {
+		return "", "", fmt.Errorf("no credentials found in env, set %s and %s", e.UserVar, e.PasswordVar)
+	}
+
+	return user, pass, nil
+}
+
+// Static is a username and password known up front, such as the ones of a
+// named account in the config file. Source names where they came from in
+// errors.
+type Static struct {
+	User     string
+	Password string
+	Source   string
+}
+
+func (s Static) Credentials(ctx context.Context) (string, string, error) {
+
+	if s.User == "" || s.Password == "" {
+		return "", "", fmt.Errorf("no credentials found for %s", s.Source)
+	}
+
+	return s.User, s.Password, nil
+}
+
+// File reads the username and password keys of a JSON file, which like the
+// token cache should only be readable by the current user.
+type File struct {
+	Path string
+}
+
+// DefaultFilePath returns $SS_CREDENTIALS_FILE, or credentials.json in the
+// ssctl config directory. Named accounts use credentials/<account>.json
+// instead.
+func DefaultFilePath(account string) (string, error) {
+
+	if account == "" {
+		if v := os.Getenv("SS_CREDENTIALS_FILE"); v != "" {
+			return v, nil
+		}
+	}
+
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	if account == "" {
+		return filepath.Join(dir, "credentials.json"), nil
+	}
+
+	return filepath.Join(dir, "credentials", account+".json"), nil
+}
+
+func (f File) Credentials(ctx context.Context) (string, string, error) {
+
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", "", fmt.Errorf("credentials file: %w", err)
+	}
+
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", "", fmt.Errorf("credentials file %s: %w", f.Path, err)
+	}
+
+	if creds.Username == "" || creds.Password == "" {
+		return "", "", fmt.Errorf("credentials file %s: username or password not set", f.Path)
+	}
+
+	return creds.Username, creds.Password, nil
+}
+
+// Preset is a token store that falls back to Token, usually from the
+// environment or the config file, when Store holds no token yet. Once tokens
+// renewed from it have been saved to Store, which Token cannot be written
+// back to, the stored token is used for as long as it is newer than Token or
+// has not expired.
+type Preset struct {
+	Token sunsynk.SSAuthToken
+	Store sunsynk.TokenStore
+}
+
+func (p Preset) LoadToken(ctx context.Context) (sunsynk.SSAuthToken, error) {
+
+	stored, err := p.Store.LoadToken(ctx)
+	if errors.Is(err, sunsynk.ErrNoToken) && p.preset() {
+		return p.Token, nil
+	}
+	if err != nil {
+		return sunsynk.SSAuthToken{}, err
+	}
+
+	if !p.preset() || current(stored, time.Now()) || newer(stored, p.Token) {
+		return stored, nil
+	}
+
+	return p.Token, nil
+}
+
+func (p Preset) SaveToken(ctx context.Context, token sunsynk.SSAuthToken) error {
+	return p.Store.SaveToken(ctx, token)
+}
+
+// preset reports whether Token holds an access or refresh token.
+func (p Preset) preset() bool {
+	return p.Token.AccessToken != "" || p.Token.RefreshToken != ""
+}
+
+// current reports whether the access token of t is known not to have
+// expired at now.
+func current(t sunsynk.SSAuthToken, now time.Time) bool {
+
+	expiry, ok := t.ExpiresAt()
+
+	return t.AccessToken != "" && ok && expiry.After(now)
+}
+
+// newer reports whether t is known to have been issued after other.
+func newer(t, other sunsynk.SSAuthToken) bool {
+
+	issued, ok := t.IssuedAt()
+	otherIssued, otherOk := other.IssuedAt()
+
+	return ok && otherOk && issued.After(otherIssued)
+}
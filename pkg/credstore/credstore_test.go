@@ -0,0 +1,67 @@
+package credstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+)
+
+type memoryStore struct {
+	token sunsynk.SSAuthToken
+	err   error
+}
+
+func (m *memoryStore) LoadToken(ctx context.Context) (sunsynk.SSAuthToken, error) {
+	return m.token, m.err
+}
+
+func (m *memoryStore) SaveToken(ctx context.Context, token sunsynk.SSAuthToken) error {
+	m.token, m.err = token, nil
+	return nil
+}
+
+func TestPreset(t *testing.T) {
+
+	now := time.Now()
+	issued := func(ago time.Duration) string { return fmt.Sprint(now.Add(-ago).Unix()) }
+
+	env := sunsynk.SSAuthToken{AccessToken: "env", RefreshToken: "env-refresh"}
+	envIssued := sunsynk.SSAuthToken{AccessToken: "env", Timestamp: issued(2 * time.Hour)}
+	current := sunsynk.SSAuthToken{AccessToken: "stored", TokenExpiry: "3600", Timestamp: issued(time.Minute)}
+	expired := sunsynk.SSAuthToken{AccessToken: "stored", TokenExpiry: "60", Timestamp: issued(time.Hour)}
+	failure := errors.New("store unavailable")
+
+	tests := []struct {
+		name    string
+		preset  sunsynk.SSAuthToken
+		store   memoryStore
+		want    string
+		wantErr error
+	}{
+		{name: "nothing stored", preset: env, store: memoryStore{err: sunsynk.ErrNoToken}, want: "env"},
+		{name: "no preset", store: memoryStore{token: expired}, want: "stored"},
+		{name: "neither", store: memoryStore{err: sunsynk.ErrNoToken}, wantErr: sunsynk.ErrNoToken},
+		{name: "stored not expired", preset: env, store: memoryStore{token: current}, want: "stored"},
+		{name: "stored expired", preset: env, store: memoryStore{token: expired}, want: "env"},
+		{name: "stored newer", preset: envIssued, store: memoryStore{token: expired}, want: "stored"},
+		{name: "store failing", preset: env, store: memoryStore{err: failure}, wantErr: failure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			store := tt.store
+			got, err := Preset{Token: tt.preset, Store: &store}.LoadToken(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got.AccessToken != tt.want {
+				t.Errorf("token = %q, want %q", got.AccessToken, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package influxdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssctl/pkg/lineprotocol"
+	"ssctl/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultPrecision is used when Config.Precision is not set.
+const DefaultPrecision = lineprotocol.Second
+
+// Config selects the InfluxDB write API and its credentials. Version 1 uses
+// /write with Database, RetentionPolicy and optional basic auth; version 2
+// uses /api/v2/write with Org, Bucket and Token.
+type Config struct {
+	URL     string
+	Version int
+
+	// InfluxDB 2.x
+	Org    string
+	Bucket string
+	Token  string
+
+	// InfluxDB 1.x
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+
+	// Precision of the timestamps: ns, us, ms or s.
+	Precision lineprotocol.Precision
+	Gzip      bool
+}
+
+// ConfigFromEnv reads the INFLUXDB_* variables. Without INFLUXDB_VERSION the
+// 2.x API is assumed when a token, org or bucket is given, 1.x otherwise.
+func ConfigFromEnv() (Config, error) {
+
+	cfg := Config{
+		URL:             os.Getenv("INFLUXDB_URL"),
+		Org:             os.Getenv("INFLUXDB_ORG"),
+		Bucket:          os.Getenv("INFLUXDB_BUCKET"),
+		Token:           os.Getenv("INFLUXDB_TOKEN"),
+		Database:        os.Getenv("INFLUXDB_DB"),
+		RetentionPolicy: os.Getenv("INFLUXDB_RP"),
+		Username:        os.Getenv("INFLUXDB_USERNAME"),
+		Password:        os.Getenv("INFLUXDB_PASSWORD"),
+		Precision:       lineprotocol.Precision(os.Getenv("INFLUXDB_PRECISION")),
+	}
+
+	switch v := os.Getenv("INFLUXDB_VERSION"); v {
+	case "":
+		cfg.Version = 1
+		if cfg.Token != "" || cfg.Org != "" || cfg.Bucket != "" {
+			cfg.Version = 2
+		}
+	case "1", "2":
+		cfg.Version, _ = strconv.Atoi(v)
+	default:
+		return cfg, fmt.Errorf("invalid INFLUXDB_VERSION %q, expected 1 or 2", v)
+	}
+
+	if v := os.Getenv("INFLUXDB_GZIP"); v != "" {
+		gz, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid INFLUXDB_GZIP %q: %w", v, err)
+		}
+		cfg.Gzip = gz
+	}
+
+	return cfg, nil
+}
+
+// Validate reports missing settings for the selected API version.
+func (c Config) Validate() error {
+
+	if c.URL == "" {
+		return fmt.Errorf("InfluxDB url not set")
+	}
+
+	if c.Precision != "" && !c.Precision.Valid() {
+		return fmt.Errorf("invalid InfluxDB precision %q, expected ns, us, ms or s", c.Precision)
+	}
+
+	switch c.Version {
+	case 1:
+	case 2:
+		if c.Org == "" || c.Bucket == "" {
+			return fmt.Errorf("InfluxDB 2.x needs an org and a bucket")
+		}
+	default:
+		return fmt.Errorf("unsupported InfluxDB version %d", c.Version)
+	}
+
+	return nil
+}
+
+// TimePrecision returns the configured precision, or DefaultPrecision.
+func (c Config) TimePrecision() lineprotocol.Precision {
+	if c.Precision == "" {
+		return DefaultPrecision
+	}
+	return c.Precision
+}
+
+// WriteError is returned when InfluxDB rejects a write. Message is the
+// reason given by the server, e.g. the line that failed to parse.
+type WriteError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *WriteError) Error() string {
+
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return "InfluxDB rejected the data: " + e.Message
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "InfluxDB denied the write, check the token or credentials: " + e.Message
+	case http.StatusNotFound:
+		return "InfluxDB database or bucket not found: " + e.Message
+	case http.StatusRequestEntityTooLarge:
+		return "InfluxDB write too large: " + e.Message
+	}
+
+	return fmt.Sprintf("InfluxDB write failed with status code %d: %s", e.StatusCode, e.Message)
+}
+
+// Writer sends line protocol to InfluxDB.
+type Writer struct {
+	Config     Config
+	HTTPClient *http.Client
+	Retry      utils.RetryPolicy
+}
+
+func NewWriter(cfg Config) (*Writer, error) {
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		Config:     cfg,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Retry:      utils.DefaultRetryPolicy,
+	}, nil
+}
+
+// Write sends newline separated line protocol. A batch refused with 413 is
+// split in half and each half written separately.
+func (w *Writer) Write(ctx context.Context, data string) error {
+
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return nil
+	}
+
+	err := w.write(ctx, data)
+
+	var writeErr *WriteError
+	if !errors.As(err, &writeErr) || writeErr.StatusCode != http.StatusRequestEntityTooLarge {
+		return err
+	}
+
+	lines := strings.Split(data, "\n")
+	if len(lines) < 2 {
+		return err
+	}
+
+	log.Debugf("InfluxDB write of %d lines too large, splitting", len(lines))
+
+	half := len(lines) / 2
+	if err := w.Write(ctx, strings.Join(lines[:half], "\n")); err != nil {
+		return err
+	}
+
+	return w.Write(ctx, strings.Join(lines[half:], "\n"))
+}
+
+func (w *Writer) write(ctx context.Context, data string) error {
+
+	endpoint, err := w.endpoint()
+	if err != nil {
+		return err
+	}
+
+	body := []byte(data)
+	if w.Config.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	_, err = w.Retry.Do(ctx, w.HTTPClient, func() (*http.Request, error) {
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		req.Header.Set("Accept", "application/json")
+		if w.Config.Gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		switch {
+		case w.Config.Token != "":
+			req.Header.Set("Authorization", "Token "+w.Config.Token)
+		case w.Config.Username != "":
+			req.SetBasicAuth(w.Config.Username, w.Config.Password)
+		}
+
+		return req, nil
+	})
+
+	var statusErr *utils.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return &WriteError{StatusCode: statusErr.StatusCode, Message: errorMessage(statusErr.Body)}
+	}
+
+	return err
+}
+
+// endpoint returns the write URL for the configured API version.
+func (w *Writer) endpoint() (string, error) {
+
+	base, err := url.Parse(strings.TrimSuffix(w.Config.URL, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid InfluxDB url: %w", err)
+	}
+
+	precision := string(w.Config.TimePrecision())
+
+	query := base.Query()
+
+	if w.Config.Version == 2 {
+		base.Path += "/api/v2/write"
+		query.Set("org", w.Config.Org)
+		query.Set("bucket", w.Config.Bucket)
+		query.Set("precision", precision)
+	} else {
+		base.Path += "/write"
+		if w.Config.Database != "" {
+			query.Set("db", w.Config.Database)
+		}
+		if w.Config.RetentionPolicy != "" {
+			query.Set("rp", w.Config.RetentionPolicy)
+		}
+		// 1.x spells nanoseconds and microseconds n and u.
+		if precision == "ns" || precision == "us" {
+			query.Set("precision", precision[:1])
+		} else {
+			query.Set("precision", precision)
+		}
+	}
+
+	base.RawQuery = query.Encode()
+
+	return base.String(), nil
+}
+
+// errorMessage extracts the reason from a 2.x {"message": ...} or 1.x
+// {"error": ...} error body, falling back to the raw body.
+func errorMessage(body []byte) string {
+
+	var resp struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+
+	if err := json.Unmarshal(body, &resp); err == nil {
+		if resp.Message != "" {
+			return resp.Message
+		}
+		if resp.Error != "" {
+			return resp.Error
+		}
+	}
+
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,199 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"ssctl/pkg/sunsynk"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultNamespace is the namespace of the secrets unless configured.
+const DefaultNamespace = "sunsynk"
+
+// SecretNames are the names of the secrets ssctl keeps its state in.
+type SecretNames struct {
+	// Credentials holds the username and password keys.
+	Credentials string
+	// Token holds the token, type, refresh, expiry, scope and timestamp keys.
+	Token string
+	// Plants holds plants.json, the plant list saved by `ssctl user`.
+	Plants string
+}
+
+// DefaultSecretNames are the secret names unless configured.
+var DefaultSecretNames = SecretNames{
+	Credentials: "sunsynk-credentials",
+	Token:       "sunsynk-token",
+	Plants:      "sunsynk-user-plants",
+}
+
+// WithSuffix returns the names with "-" and suffix appended, or the names
+// unchanged when suffix is empty.
+func (n SecretNames) WithSuffix(suffix string) SecretNames {
+
+	if suffix == "" {
+		return n
+	}
+
+	return SecretNames{
+		Credentials: n.Credentials + "-" + suffix,
+		Token:       n.Token + "-" + suffix,
+		Plants:      n.Plants + "-" + suffix,
+	}
+}
+
+// Store reads and writes the secrets of one ssctl install, in a single
+// namespace under configurable names, so that several installs can share a
+// cluster.
+type Store struct {
+	Clientset *kubernetes.Clientset
+	Namespace string
+	Names     SecretNames
+}
+
+// Get returns the data of the named secret.
+func (s *Store) Get(ctx context.Context, name string) (map[string][]byte, error) {
+
+	secret, err := s.Clientset.CoreV1().Secrets(s.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s: %w", s.Namespace, name, err)
+	}
+
+	return secret.Data, nil
+}
+
+// Put writes data into the named secret, creating it when it does not exist
+// and otherwise keeping the keys not in data.
+func (s *Store) Put(ctx context.Context, name string, data map[string][]byte) error {
+
+	secrets := s.Clientset.CoreV1().Secrets(s.Namespace)
+
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: s.Namespace,
+			},
+			Type: "Opaque",
+			Data: data,
+		}
+
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("secret %s/%s: %w", s.Namespace, name, err)
+		}
+		log.Printf("Created secret %s/%s.", s.Namespace, name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("secret %s/%s: %w", s.Namespace, name, err)
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	for k, v := range data {
+		secret.Data[k] = v
+	}
+
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("secret %s/%s: %w", s.Namespace, name, err)
+	}
+	log.Printf("Updated secret %s/%s.", s.Namespace, name)
+
+	return nil
+}
+
+// GetJSON decodes the JSON document stored under key of the named secret
+// into v.
+func (s *Store) GetJSON(ctx context.Context, name, key string, v interface{}) error {
+
+	data, err := s.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return fmt.Errorf("secret %s/%s: %s not found in secret data", s.Namespace, name, key)
+	}
+
+	if err := json.Unmarshal(value, v); err != nil {
+		return fmt.Errorf("secret %s/%s: %s: %w", s.Namespace, name, key, err)
+	}
+
+	return nil
+}
+
+// PutJSON stores v as a JSON document under key of the named secret.
+func (s *Store) PutJSON(ctx context.Context, name, key string, v interface{}) error {
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, name, map[string][]byte{key: value})
+}
+
+// Credentials reads the username and password keys of the credentials
+// secret, making the store a sunsynk.CredentialStore.
+func (s *Store) Credentials(ctx context.Context) (string, string, error) {
+
+	data, err := s.Get(ctx, s.Names.Credentials)
+	if err != nil {
+		return "", "", err
+	}
+
+	username, ok := data["username"]
+	if !ok {
+		return "", "", fmt.Errorf("secret %s/%s: username not found in secret data", s.Namespace, s.Names.Credentials)
+	}
+
+	password, ok := data["password"]
+	if !ok {
+		return "", "", fmt.Errorf("secret %s/%s: password not found in secret data", s.Namespace, s.Names.Credentials)
+	}
+
+	return string(username), string(password), nil
+}
+
+// LoadToken reads the token secret, making the store a sunsynk.TokenStore.
+// Only a missing secret is reported as sunsynk.ErrNoToken: any other failure,
+// such as a denied read, must not lead to a login that overwrites the token.
+func (s *Store) LoadToken(ctx context.Context) (sunsynk.SSAuthToken, error) {
+
+	data, err := s.Get(ctx, s.Names.Token)
+	if apierrors.IsNotFound(err) {
+		return sunsynk.SSAuthToken{}, sunsynk.ErrNoToken
+	}
+	if err != nil {
+		return sunsynk.SSAuthToken{}, err
+	}
+
+	token := map[string]string{}
+	for k, v := range data {
+		token[k] = string(v)
+	}
+
+	return sunsynk.TokenFromMap(token), nil
+}
+
+// SaveToken writes token into the token secret.
+func (s *Store) SaveToken(ctx context.Context, token sunsynk.SSAuthToken) error {
+
+	data := map[string][]byte{}
+	for k, v := range token.Map() {
+		data[k] = []byte(v)
+	}
+
+	return s.Put(ctx, s.Names.Token, data)
+}
@@ -0,0 +1,218 @@
+package lineprotocol
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Precision is the unit of the point timestamps, as understood by the
+// InfluxDB precision parameter.
+type Precision string
+
+const (
+	Nanosecond  Precision = "ns"
+	Microsecond Precision = "us"
+	Millisecond Precision = "ms"
+	Second      Precision = "s"
+)
+
+// Valid reports whether p is one of the supported precisions.
+func (p Precision) Valid() bool {
+	switch p {
+	case Nanosecond, Microsecond, Millisecond, Second:
+		return true
+	}
+	return false
+}
+
+// Timestamp returns t as an integer count of p since the unix epoch.
+func (p Precision) Timestamp(t time.Time) int64 {
+	switch p {
+	case Nanosecond:
+		return t.UnixNano()
+	case Microsecond:
+		return t.UnixMicro()
+	case Millisecond:
+		return t.UnixMilli()
+	}
+	return t.Unix()
+}
+
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Field is a single field of a point. Value must be a float64, an int64 (or
+// int), a string or a bool.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Point is one line of line protocol. Tags are written sorted by key, as
+// InfluxDB recommends, and empty tag values are left out.
+type Point struct {
+	Measurement string
+	Tags        []Tag
+	Fields      []Field
+	Time        time.Time
+}
+
+// Encoder renders points as line protocol.
+type Encoder struct {
+	Precision Precision
+}
+
+// Encode returns the line for p, without a trailing newline.
+func (e Encoder) Encode(p Point) (string, error) {
+
+	if p.Measurement == "" {
+		return "", fmt.Errorf("point has no measurement")
+	}
+	if len(p.Fields) == 0 {
+		return "", fmt.Errorf("point %s has no fields", p.Measurement)
+	}
+
+	var b strings.Builder
+
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+
+	tags := append([]Tag(nil), p.Tags...)
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Key < tags[j].Key
+	})
+	for _, tag := range tags {
+		if tag.Key == "" || tag.Value == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(tag.Key))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(tag.Value))
+	}
+
+	for i, field := range p.Fields {
+		if field.Key == "" {
+			return "", fmt.Errorf("point %s has a field without a key", p.Measurement)
+		}
+		value, err := fieldValue(field.Value)
+		if err != nil {
+			return "", fmt.Errorf("field %s of %s: %w", field.Key, p.Measurement, err)
+		}
+
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyEscaper.Replace(field.Key))
+		b.WriteByte('=')
+		b.WriteString(value)
+	}
+
+	if !p.Time.IsZero() {
+		precision := e.Precision
+		if precision == "" {
+			precision = Nanosecond
+		}
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(precision.Timestamp(p.Time), 10))
+	}
+
+	return b.String(), nil
+}
+
+// EncodeAll encodes every point, one per line.
+func (e Encoder) EncodeAll(points []Point) ([]string, error) {
+
+	lines := make([]string, 0, len(points))
+
+	for _, p := range points {
+		line, err := e.Encode(p)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// Group merges points with the same measurement, tag set and timestamp into
+// a single point carrying all of their fields. The order of first
+// appearance is kept.
+func Group(points []Point) []Point {
+
+	var grouped []Point
+	index := map[string]int{}
+
+	for _, p := range points {
+
+		key := seriesKey(p)
+
+		if i, ok := index[key]; ok {
+			grouped[i].Fields = append(grouped[i].Fields, p.Fields...)
+			continue
+		}
+
+		index[key] = len(grouped)
+		p.Fields = append([]Field(nil), p.Fields...)
+		grouped = append(grouped, p)
+	}
+
+	return grouped
+}
+
+func seriesKey(p Point) string {
+
+	tags := append([]Tag(nil), p.Tags...)
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Key < tags[j].Key
+	})
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+	for _, tag := range tags {
+		if tag.Key == "" || tag.Value == "" {
+			continue
+		}
+		b.WriteString("," + keyEscaper.Replace(tag.Key) + "=" + keyEscaper.Replace(tag.Value))
+	}
+	b.WriteString(" " + strconv.FormatInt(p.Time.UnixNano(), 10))
+
+	return b.String()
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+func fieldValue(v interface{}) (string, error) {
+
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("%v is not a valid float", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return fieldValue(float64(v))
+	case int:
+		return strconv.Itoa(v) + "i", nil
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`, nil
+	}
+
+	return "", fmt.Errorf("unsupported field type %T", v)
+}
@@ -0,0 +1,142 @@
+package lineprotocol
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+
+	tests := []struct {
+		name      string
+		point     Point
+		precision Precision
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:  "plain",
+			point: Point{Measurement: "sunsynk_plant", Fields: []Field{{"pv", 1.5}}},
+			want:  "sunsynk_plant pv=1.5",
+		},
+		{
+			name: "tags sorted and empty ones dropped",
+			point: Point{
+				Measurement: "m",
+				Tags:        []Tag{{"plant_name", "Home"}, {"inverter", ""}, {"account", "acme"}},
+				Fields:      []Field{{"v", 1.0}},
+			},
+			want: "m,account=acme,plant_name=Home v=1",
+		},
+		{
+			name: "escaping",
+			point: Point{
+				Measurement: "my plant,x",
+				Tags:        []Tag{{"plant name", `Home, "Sweet"=Home\`}},
+				Fields:      []Field{{"field key=", `say "hi" \ bye`}},
+			},
+			want: `my\ plant\,x,plant\ name=Home\,\ "Sweet"\=Home\\ field\ key\=="say \"hi\" \\ bye"`,
+		},
+		{
+			name:  "field types",
+			point: Point{Measurement: "m", Fields: []Field{{"f", 0.1}, {"i", 42}, {"i64", int64(-7)}, {"b", true}, {"s", "on"}, {"f32", float32(2)}}},
+			want:  `m f=0.1,i=42i,i64=-7i,b=true,s="on",f32=2`,
+		},
+		{
+			name:  "default precision",
+			point: Point{Measurement: "m", Fields: []Field{{"v", 1.0}}, Time: ts},
+			want:  "m v=1 1704164645123456789",
+		},
+		{
+			name:      "second precision",
+			point:     Point{Measurement: "m", Fields: []Field{{"v", 1.0}}, Time: ts},
+			precision: Second,
+			want:      "m v=1 1704164645",
+		},
+		{
+			name:      "millisecond precision",
+			point:     Point{Measurement: "m", Fields: []Field{{"v", 1.0}}, Time: ts},
+			precision: Millisecond,
+			want:      "m v=1 1704164645123",
+		},
+		{
+			name:      "microsecond precision",
+			point:     Point{Measurement: "m", Fields: []Field{{"v", 1.0}}, Time: ts},
+			precision: Microsecond,
+			want:      "m v=1 1704164645123456",
+		},
+		{name: "no measurement", point: Point{Fields: []Field{{"v", 1.0}}}, wantErr: true},
+		{name: "no fields", point: Point{Measurement: "m"}, wantErr: true},
+		{name: "field without key", point: Point{Measurement: "m", Fields: []Field{{"", 1.0}}}, wantErr: true},
+		{name: "NaN", point: Point{Measurement: "m", Fields: []Field{{"v", math.NaN()}}}, wantErr: true},
+		{name: "infinity", point: Point{Measurement: "m", Fields: []Field{{"v", math.Inf(1)}}}, wantErr: true},
+		{name: "unsupported type", point: Point{Measurement: "m", Fields: []Field{{"v", []int{1}}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, err := Encoder{Precision: tt.precision}.Encode(tt.point)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrecisionValid(t *testing.T) {
+
+	for _, p := range []Precision{Nanosecond, Microsecond, Millisecond, Second} {
+		if !p.Valid() {
+			t.Errorf("%q not valid", p)
+		}
+	}
+	for _, p := range []Precision{"", "h", "m", "n", "u"} {
+		if p.Valid() {
+			t.Errorf("%q valid", p)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+
+	t1 := time.Unix(100, 0)
+	t2 := time.Unix(200, 0)
+	home := []Tag{{"plant_id", "1"}, {"inverter", "A"}}
+	// The same tags in another order, and with an empty tag, are the same
+	// series.
+	homeReordered := []Tag{{"inverter", "A"}, {"plant_id", "1"}, {"account", ""}}
+
+	points := []Point{
+		{Measurement: "m", Tags: home, Fields: []Field{{"pv", 1.0}}, Time: t1},
+		{Measurement: "m", Tags: home, Fields: []Field{{"pv", 2.0}}, Time: t2},
+		{Measurement: "m", Tags: homeReordered, Fields: []Field{{"load", 3.0}}, Time: t1},
+		{Measurement: "m", Tags: []Tag{{"plant_id", "2"}}, Fields: []Field{{"pv", 4.0}}, Time: t1},
+		{Measurement: "other", Tags: home, Fields: []Field{{"pv", 5.0}}, Time: t1},
+		{Measurement: "m", Tags: home, Fields: []Field{{"grid", 6.0}}, Time: t2},
+	}
+
+	want := []Point{
+		{Measurement: "m", Tags: home, Fields: []Field{{"pv", 1.0}, {"load", 3.0}}, Time: t1},
+		{Measurement: "m", Tags: home, Fields: []Field{{"pv", 2.0}, {"grid", 6.0}}, Time: t2},
+		{Measurement: "m", Tags: []Tag{{"plant_id", "2"}}, Fields: []Field{{"pv", 4.0}}, Time: t1},
+		{Measurement: "other", Tags: home, Fields: []Field{{"pv", 5.0}}, Time: t1},
+	}
+
+	got := Group(points)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Group =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Grouping must not append to the fields of the input points.
+	if len(points[0].Fields) != 1 {
+		t.Errorf("Group changed its input: %+v", points[0])
+	}
+}
@@ -0,0 +1,275 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format served by Handler.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Labels identify one series of a metric.
+type Labels map[string]string
+
+// Registry holds metric families and renders them in the Prometheus text
+// exposition format.
+type Registry struct {
+	mu       sync.Mutex
+	families []*Vec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Gauge registers a metric whose value can go up and down.
+func (r *Registry) Gauge(name, help string) *Vec {
+	return r.register(name, help, "gauge")
+}
+
+// Counter registers a metric that only increases.
+func (r *Registry) Counter(name, help string) *Vec {
+	return r.register(name, help, "counter")
+}
+
+func (r *Registry) register(name, help, kind string) *Vec {
+
+	if !metricName.MatchString(name) {
+		panic("metrics: invalid metric name " + strconv.Quote(name))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.families {
+		if v.name == name {
+			panic("metrics: duplicate metric " + name)
+		}
+	}
+
+	v := &Vec{name: name, help: help, kind: kind, series: map[string]*series{}}
+	r.families = append(r.families, v)
+
+	return v
+}
+
+// Vec is a metric family with one series per label set.
+type Vec struct {
+	name string
+	help string
+	kind string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels Labels
+	value  float64
+}
+
+// Set sets the value of the series. For counters it is meant for totals
+// reported by the source, e.g. the lifetime energy of an inverter.
+func (v *Vec) Set(labels Labels, value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(labels).value = value
+}
+
+// Add adds delta to the value of the series.
+func (v *Vec) Add(labels Labels, delta float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(labels).value += delta
+}
+
+// Inc adds one to the value of the series.
+func (v *Vec) Inc(labels Labels) {
+	v.Add(labels, 1)
+}
+
+// Delete removes the series, e.g. once the inverter it describes is gone.
+func (v *Vec) Delete(labels Labels) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.series, formatLabels(labels))
+}
+
+// DeleteMatching removes every series whose labels include all of labels.
+func (v *Vec) DeleteMatching(labels Labels) {
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for key, s := range v.series {
+		match := true
+		for name, value := range labels {
+			if s.labels[name] != value {
+				match = false
+				break
+			}
+		}
+		if match {
+			delete(v.series, key)
+		}
+	}
+}
+
+func (v *Vec) get(labels Labels) *series {
+
+	key := formatLabels(labels)
+
+	s, ok := v.series[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for name, value := range labels {
+			if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+				panic("metrics: invalid label name " + strconv.Quote(name) + " of " + v.name)
+			}
+			copied[name] = value
+		}
+		s = &series{labels: copied}
+		v.series[key] = s
+	}
+
+	return s
+}
+
+func (v *Vec) write(w *bufio.Writer) {
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.series) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		w.WriteString(v.name)
+		w.WriteString(key)
+		w.WriteByte(' ')
+		w.WriteString(formatValue(v.series[key].value))
+		w.WriteByte('\n')
+	}
+}
+
+// WriteTo renders every metric with at least one series.
+func (r *Registry) WriteTo(out io.Writer) (int64, error) {
+
+	r.mu.Lock()
+	families := append([]*Vec(nil), r.families...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: out}
+	w := bufio.NewWriter(cw)
+
+	for _, v := range families {
+		v.write(w)
+	}
+
+	err := w.Flush()
+
+	return cw.n, err
+}
+
+// Handler serves the registry, for mounting on /metrics.
+func (r *Registry) Handler() http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// formatLabels renders labels sorted by name, e.g. {inverter="SN1",plant="1"}.
+// Empty values are left out, as Prometheus treats them as absent.
+func formatLabels(labels Labels) string {
+
+	names := make([]string, 0, len(labels))
+	for name, value := range labels {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(labels[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// metricName and labelName are the names the exposition format allows;
+// label names starting with __ are reserved for Prometheus itself.
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelName  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestWriteTo(t *testing.T) {
+
+	r := NewRegistry()
+
+	power := r.Gauge("sunsynk_pv_power_watts", "PV power.\nIn watts, see \\docs.")
+	power.Set(Labels{"plant_id": "1", "plant_name": `Home "North"`}, 1500)
+	power.Set(Labels{"plant_id": "2", "plant_name": "Barn\\Shed\nWest", "inverter": ""}, 0.25)
+
+	errors := r.Counter("sunsynk_api_errors_total", "API errors.")
+	errors.Inc(nil)
+	errors.Inc(nil)
+
+	special := r.Gauge("special_values", "NaN and infinities.")
+	special.Set(Labels{"v": "nan"}, math.NaN())
+	special.Set(Labels{"v": "pos"}, math.Inf(1))
+	special.Set(Labels{"v": "neg"}, math.Inf(-1))
+
+	r.Gauge("unused", "Never set, so not written.")
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP sunsynk_pv_power_watts PV power.\nIn watts, see \\docs.
+# TYPE sunsynk_pv_power_watts gauge
+sunsynk_pv_power_watts{plant_id="1",plant_name="Home \"North\""} 1500
+sunsynk_pv_power_watts{plant_id="2",plant_name="Barn\\Shed\nWest"} 0.25
+# HELP sunsynk_api_errors_total API errors.
+# TYPE sunsynk_api_errors_total counter
+sunsynk_api_errors_total 2
+# HELP special_values NaN and infinities.
+# TYPE special_values gauge
+special_values{v="nan"} NaN
+special_values{v="neg"} -Inf
+special_values{v="pos"} +Inf
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	// The output must parse with the Prometheus text parser and give back
+	// the original, unescaped values.
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("exposition does not parse: %v", err)
+	}
+
+	family, ok := families["sunsynk_pv_power_watts"]
+	if !ok {
+		t.Fatal("sunsynk_pv_power_watts missing")
+	}
+	if got := family.GetHelp(); got != "PV power.\nIn watts, see \\docs." {
+		t.Errorf("help = %q", got)
+	}
+
+	values := map[string]float64{}
+	for _, m := range family.GetMetric() {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "plant_name" {
+				values[l.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	if values[`Home "North"`] != 1500 || values["Barn\\Shed\nWest"] != 0.25 {
+		t.Errorf("parsed label values = %v", values)
+	}
+
+	if got := families["sunsynk_api_errors_total"].GetMetric()[0].GetCounter().GetValue(); got != 2 {
+		t.Errorf("counter = %v, want 2", got)
+	}
+}
+
+func TestDelete(t *testing.T) {
+
+	r := NewRegistry()
+	v := r.Gauge("g", "Gauge.")
+
+	v.Set(Labels{"account": "a", "plant_id": "1"}, 1)
+	v.Set(Labels{"account": "a", "plant_id": "2"}, 2)
+	v.Set(Labels{"account": "b", "plant_id": "1"}, 3)
+
+	v.Delete(Labels{"account": "b", "plant_id": "1"})
+	v.DeleteMatching(Labels{"plant_id": "2"})
+
+	var b strings.Builder
+	r.WriteTo(&b)
+
+	want := "# HELP g Gauge.\n# TYPE g gauge\ng{account=\"a\",plant_id=\"1\"} 1\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+
+	tests := []struct {
+		name string
+		f    func(r *Registry)
+	}{
+		{"metric with dash", func(r *Registry) { r.Gauge("pv-power", "") }},
+		{"metric starting with digit", func(r *Registry) { r.Gauge("1pv", "") }},
+		{"duplicate metric", func(r *Registry) { r.Gauge("pv", ""); r.Counter("pv", "") }},
+		{"label with dash", func(r *Registry) { r.Gauge("pv", "").Set(Labels{"plant-id": "1"}, 1) }},
+		{"reserved label", func(r *Registry) { r.Gauge("pv", "").Set(Labels{"__name__": "x"}, 1) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("did not panic")
+				}
+			}()
+			tt.f(NewRegistry())
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+
+	r := NewRegistry()
+	r.Gauge("up", "Up.").Set(nil, 1)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "\nup 1\n") {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Task is a job run repeatedly by a Scheduler.
+type Task struct {
+	Name     string
+	Interval time.Duration
+	// Jitter randomises each wait by +/- this fraction of Interval (0 to 1)
+	// so that tasks sharing an interval do not hit the API together.
+	Jitter float64
+	// Delay postpones the first run. Without it the task runs as soon as
+	// the scheduler starts.
+	Delay time.Duration
+	Run   func(ctx context.Context) error
+}
+
+// Scheduler runs each of its tasks in its own goroutine. A task never
+// overlaps with itself: the next wait starts once a run has finished.
+type Scheduler struct {
+	// OnRun, when set, is called after every run, e.g. to record metrics.
+	// Failed runs are logged either way.
+	OnRun func(name string, duration time.Duration, err error)
+
+	tasks []Task
+}
+
+func (s *Scheduler) Add(task Task) {
+	s.tasks = append(s.tasks, task)
+}
+
+// Run starts every task and blocks until ctx is cancelled and the runs in
+// flight have returned.
+func (s *Scheduler) Run(ctx context.Context) {
+
+	var wg sync.WaitGroup
+
+	for _, task := range s.tasks {
+		task := task
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, task)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, task Task) {
+
+	wait := task.Delay
+
+	for {
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.run(ctx, task)
+
+		wait = jitter(task.Interval, task.Jitter)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, task Task) {
+
+	start := time.Now()
+	err := task.Run(ctx)
+	duration := time.Since(start)
+
+	if err != nil && ctx.Err() == nil {
+		log.Warnf("Task %s failed after %s: %v", task.Name, duration.Round(time.Millisecond), err)
+	} else {
+		log.Debugf("Task %s finished in %s", task.Name, duration.Round(time.Millisecond))
+	}
+
+	if s.OnRun != nil {
+		s.OnRun(task.Name, duration, err)
+	}
+}
+
+func jitter(d time.Duration, fraction float64) time.Duration {
+
+	if fraction <= 0 {
+		return d
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	delta := float64(d) * fraction
+
+	return time.Duration(float64(d) - delta + rand.Float64()*2*delta)
+}
@@ -0,0 +1,165 @@
+package sunsynk
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// FaultCode is the code an inverter reports a fault or warning with, e.g.
+// F35.
+type FaultCode string
+
+// faultDescriptions are the faults documented in the inverter manuals.
+var faultDescriptions = map[FaultCode]string{
+	"F01": "DC input polarity reversed",
+	"F07": "DC start up failure",
+	"F08": "GFDI relay failure",
+	"F13": "Working mode changed",
+	"F15": "AC over current (software)",
+	"F16": "GFCI failure",
+	"F18": "AC over current (hardware)",
+	"F20": "DC over current (hardware)",
+	"F22": "Emergency stop",
+	"F23": "AC leakage current over limit",
+	"F24": "DC insulation impedance failure",
+	"F26": "DC busbar imbalanced",
+	"F29": "Parallel CAN bus failure",
+	"F34": "AC overload",
+	"F35": "No AC grid",
+	"F41": "Parallel system stopped",
+	"F42": "AC line voltage low",
+	"F46": "Backup battery failure",
+	"F47": "AC over frequency",
+	"F48": "AC under frequency",
+	"F56": "DC busbar voltage too low",
+	"F58": "BMS communication failure",
+	"F63": "Arc fault",
+	"F64": "Heat sink temperature too high",
+}
+
+// Description returns what the code means, or "" for codes we do not know.
+func (c FaultCode) Description() string {
+	return faultDescriptions[FaultCode(strings.ToUpper(string(c)))]
+}
+
+// AlarmLevel is the severity of an alarm.
+type AlarmLevel int
+
+const (
+	AlarmInfo    AlarmLevel = 0
+	AlarmWarning AlarmLevel = 1
+	AlarmFault   AlarmLevel = 2
+)
+
+func (l AlarmLevel) String() string {
+	switch l {
+	case AlarmInfo:
+		return "info"
+	case AlarmWarning:
+		return "warning"
+	case AlarmFault:
+		return "fault"
+	}
+	return strconv.Itoa(int(l))
+}
+
+// AlarmStatus tells whether an alarm is still active.
+type AlarmStatus int
+
+const (
+	AlarmActive    AlarmStatus = 0
+	AlarmRecovered AlarmStatus = 1
+)
+
+func (s AlarmStatus) String() string {
+	if s == AlarmRecovered {
+		return "recovered"
+	}
+	return "active"
+}
+
+// SSApiAlarm is a fault or event raised by an inverter. Times are wall-clock
+// times in the plant's timezone, e.g. 2025-03-01 14:05:00.
+type SSApiAlarm struct {
+	Id           int         `json:"id"`
+	Sn           string      `json:"sn"`
+	PlantId      int         `json:"stationId"`
+	PlantName    string      `json:"stationName"`
+	Code         FaultCode   `json:"eventCode"`
+	Description  string      `json:"eventDescription"`
+	Level        AlarmLevel  `json:"eventType"`
+	Status       AlarmStatus `json:"status"`
+	Time         string      `json:"eventTime"`
+	RecoveryTime string      `json:"recoveryTime"`
+}
+
+// Message returns the description the API gave, falling back to the one of
+// the fault code.
+func (a SSApiAlarm) Message() string {
+	if a.Description != "" {
+		return a.Description
+	}
+	return a.Code.Description()
+}
+
+type SSApiAlarmsResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"msg"`
+	Data    struct {
+		PageSize   int          `json:"pageSize"`
+		PageNumber int          `json:"pageNumber"`
+		Total      int          `json:"total"`
+		Infos      []SSApiAlarm `json:"infos"`
+	} `json:"data"`
+	Success bool `json:"success"`
+}
+
+// GetPlantAlarmsPage fetches one page of the alarms of every inverter of a
+// plant raised between the dates from and to, inclusive.
+func (c *Client) GetPlantAlarmsPage(ctx context.Context, plantid, from, to string, page, limit int) (SSApiAlarmsResponse, error) {
+
+	var d SSApiAlarmsResponse
+	err := c.get(ctx, "/api/v1/plant/"+plantid+"/events", alarmsQuery(from, to, page, limit), &d)
+	return d, err
+}
+
+// PlantAlarms iterates over the alarms of a plant raised between from and to.
+func (c *Client) PlantAlarms(plantid, from, to string) *Iterator[SSApiAlarm] {
+	return NewIterator(c.PageSize, func(ctx context.Context, page, limit int) ([]SSApiAlarm, int, error) {
+		d, err := c.GetPlantAlarmsPage(ctx, plantid, from, to, page, limit)
+		return d.Data.Infos, d.Data.Total, err
+	})
+}
+
+// GetInverterAlarmsPage fetches one page of the alarms of an inverter raised
+// between the dates from and to, inclusive.
+func (c *Client) GetInverterAlarmsPage(ctx context.Context, inverterid, from, to string, page, limit int) (SSApiAlarmsResponse, error) {
+
+	var d SSApiAlarmsResponse
+	err := c.get(ctx, "/api/v1/inverter/"+inverterid+"/events", alarmsQuery(from, to, page, limit), &d)
+	return d, err
+}
+
+// InverterAlarms iterates over the alarms of an inverter raised between from
+// and to.
+func (c *Client) InverterAlarms(inverterid, from, to string) *Iterator[SSApiAlarm] {
+	return NewIterator(c.PageSize, func(ctx context.Context, page, limit int) ([]SSApiAlarm, int, error) {
+		d, err := c.GetInverterAlarmsPage(ctx, inverterid, from, to, page, limit)
+		return d.Data.Infos, d.Data.Total, err
+	})
+}
+
+func alarmsQuery(from, to string, page, limit int) url.Values {
+
+	query := url.Values{}
+	query.Set("lan", "en")
+	query.Set("sdate", from)
+	query.Set("edate", to)
+	query.Set("type", "-1")
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(limit))
+
+	return query
+}
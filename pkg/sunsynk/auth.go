@@ -1,106 +1,53 @@
 package sunsynk
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os"
-	"time"
 )
 
-var SSApiTokenEndpoint = func() string {
-	if v := os.Getenv("SS_API_ENDPOINT"); v != "" {
-		return v + "/oauth/token/new"
-	}
-	return "https://api.sunsynk.net/oauth/token/new"
-}()
-
-type SSApiTokenResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"msg"`
-	Success bool   `json:"success"`
-	Data    struct {
-		AccessToken  string `json:"access_token"`
-		TokenType    string `json:"token_type"`
-		RefreshToken string `json:"refresh_token"`
-		TokenExpiry  int    `json:"expires_in"`
-		Scope        string `json:"scope"`
-	} `json:"data"`
-}
-
+// SSApiErrorResponse is the body returned alongside non-2xx statuses.
 type SSApiErrorResponse struct {
-	Timestamp string `json:"timestamp"`
-	Status    int    `json:"status"`
-	Error     error  `json:"error"`
-	Path      string `json:"path"`
+	Timestamp        string `json:"timestamp"`
+	Status           int    `json:"status"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	Path             string `json:"path"`
+	Code             int    `json:"code"`
+	Message          string `json:"msg"`
 }
 
-func GetAuthToken(user, pass string) (SSApiTokenResponse, error) {
-
-	httpClient := http.Client{
-		Timeout: time.Second * 30,
-	}
+// RefreshToken exchanges a refresh token for a new access token using the
+// OAuth refresh_token grant.
+func (c *Client) RefreshToken(ctx context.Context, refreshToken string) (SSApiNewTokenResponse, error) {
 
 	type PostBody struct {
-		Username  string `json:"username"`
-		Password  string `json:"password"`
-		GrantType string `json:"grant_type"`
-		ClientId  string `json:"client_id"`
-		Source    string `json:"source"`
-		AreaCode  string `json:"areaCode"`
-	}
-
-	postbody := PostBody{
-		Username:  user,
-		Password:  pass,
-		GrantType: "password",
-		ClientId:  "csp-web",
-		Source:    "sunsynk",
-		AreaCode:  "elinter",
-	}
-
-	postbodyJSON, err := json.Marshal(postbody)
-	if err != nil {
-		return SSApiTokenResponse{}, err
+		ClientId     string `json:"client_id"`
+		GrantType    string `json:"grant_type"`
+		RefreshToken string `json:"refresh_token"`
+		Source       string `json:"source"`
 	}
 
-	req, err := http.NewRequest("POST", SSApiTokenEndpoint, bytes.NewBuffer(postbodyJSON))
+	postbodyJSON, err := json.Marshal(PostBody{
+		ClientId:     "csp-web",
+		GrantType:    "refresh_token",
+		RefreshToken: refreshToken,
+		Source:       "sunsynk",
+	})
 	if err != nil {
-		return SSApiTokenResponse{}, err
+		return SSApiNewTokenResponse{}, err
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := httpClient.Do(req)
+	body, err := c.do(ctx, "POST", "/oauth/token/new", nil, postbodyJSON, false)
 	if err != nil {
-		return SSApiTokenResponse{}, err
+		return SSApiNewTokenResponse{}, err
 	}
 
-	if res.Body != nil {
-		defer res.Body.Close()
+	d := SSApiNewTokenResponse{}
+	if err := json.Unmarshal(body, &d); err != nil {
+		return SSApiNewTokenResponse{}, err
 	}
-
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return SSApiTokenResponse{}, err
-	}
-
-	d := SSApiTokenResponse{}
-	e := SSApiErrorResponse{}
-
-	if res.StatusCode == 200 {
-		err := json.Unmarshal(body, &d)
-		if err != nil {
-			return SSApiTokenResponse{}, err
-		}
-		return d, nil
-	} else {
-		err := json.Unmarshal(body, &e)
-		if err != nil {
-			return SSApiTokenResponse{}, err
-		}
-		return d, fmt.Errorf("error: %s path: %s status: %d timestamp: %s", e.Error, e.Path, e.Status, e.Path)
+	if d.Data.AccessToken == "" {
+		return d, &APIError{StatusCode: 200, Code: d.Code, Message: "refresh failed: " + d.Message, Path: "/oauth/token/new"}
 	}
+	return d, nil
 }
@@ -1,7 +1,7 @@
 package sunsynk
 
 import (
-	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
@@ -11,21 +11,11 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 )
 
-var SSApiNewTokenEndpoint = func() string {
-	if v := os.Getenv("SS_API_ENDPOINT"); v != "" {
-		return v + "/oauth/token/new"
-	}
-	return "https://api.sunsynk.net/oauth/token/new"
-}()
-
 type SSApiNewTokenResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"msg"`
@@ -39,13 +29,6 @@ type SSApiNewTokenResponse struct {
 	} `json:"data"`
 }
 
-type SSApiNewErrorResponse struct {
-	Timestamp string `json:"timestamp"`
-	Status    int    `json:"status"`
-	Error     error  `json:"error"`
-	Path      string `json:"path"`
-}
-
 // Matches python: response.json()['data']
 type publicKeyResponse struct {
 	Data string `json:"data"`
@@ -84,17 +67,8 @@ func loadRSAPublicKeyFromBareString(bare string) (*rsa.PublicKey, error) {
 	return pub, nil
 }
 
-func GetNewAuthToken(user, pass string) (SSApiNewTokenResponse, error) {
-	httpClient := http.Client{
-		Timeout: time.Second * 30,
-	}
-
-	// Derive API server host from SSApiNewTokenEndpoint
-	tokenURL, err := url.Parse(SSApiNewTokenEndpoint)
-	if err != nil {
-		return SSApiNewTokenResponse{}, err
-	}
-	apiServer := tokenURL.Host
+// Login performs the RSA password grant used by the Sunsynk web UI.
+func (c *Client) Login(ctx context.Context, user, pass string) (SSApiNewTokenResponse, error) {
 
 	source := "sunsynk"
 
@@ -102,35 +76,15 @@ func GetNewAuthToken(user, pass string) (SSApiNewTokenResponse, error) {
 	publicKeySigInput := fmt.Sprintf("nonce=%d&source=%sPOWER_VIEW", publicKeyNonce, source)
 	publicKeySign := md5Hex(publicKeySigInput)
 
-	publicKeyURL := url.URL{
-		Scheme: tokenURL.Scheme,
-		Host:   apiServer,
-		Path:   "/anonymous/publicKey",
-	}
-	q := publicKeyURL.Query()
+	q := url.Values{}
 	q.Set("source", source)
 	q.Set("nonce", fmt.Sprintf("%d", publicKeyNonce))
 	q.Set("sign", publicKeySign)
-	publicKeyURL.RawQuery = q.Encode()
-
-	reqPK, err := http.NewRequest("GET", publicKeyURL.String(), nil)
-	if err != nil {
-		return SSApiNewTokenResponse{}, err
-	}
 
-	resPK, err := httpClient.Do(reqPK)
+	pkBody, err := c.do(ctx, "GET", "/anonymous/publicKey", q, nil, false)
 	if err != nil {
 		return SSApiNewTokenResponse{}, err
 	}
-	defer resPK.Body.Close()
-
-	pkBody, err := io.ReadAll(resPK.Body)
-	if err != nil {
-		return SSApiNewTokenResponse{}, err
-	}
-	if resPK.StatusCode < 200 || resPK.StatusCode > 299 {
-		return SSApiNewTokenResponse{}, fmt.Errorf("publicKey http %d: %s", resPK.StatusCode, string(pkBody))
-	}
 
 	var pkResp publicKeyResponse
 	if err := json.Unmarshal(pkBody, &pkResp); err != nil {
@@ -186,37 +140,17 @@ func GetNewAuthToken(user, pass string) (SSApiNewTokenResponse, error) {
 		return SSApiNewTokenResponse{}, err
 	}
 
-	req, err := http.NewRequest("POST", SSApiNewTokenEndpoint, bytes.NewBuffer(postbodyJSON))
-	if err != nil {
-		return SSApiNewTokenResponse{}, err
-	}
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := httpClient.Do(req)
+	body, err := c.do(ctx, "POST", "/oauth/token/new", nil, postbodyJSON, false)
 	if err != nil {
 		return SSApiNewTokenResponse{}, err
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
+	d := SSApiNewTokenResponse{}
+	if err := json.Unmarshal(body, &d); err != nil {
 		return SSApiNewTokenResponse{}, err
 	}
-
-	d := SSApiNewTokenResponse{}
-	e := SSApiNewErrorResponse{}
-
-	if res.StatusCode == 200 {
-		if err := json.Unmarshal(body, &d); err != nil {
-			return SSApiNewTokenResponse{}, err
-		}
-		if d.Message != "Success" || d.Data.AccessToken == "" {
-			return d, fmt.Errorf("login failed: msg=%q", d.Message)
-		}
-		return d, nil
+	if d.Data.AccessToken == "" {
+		return d, &APIError{StatusCode: 200, Code: d.Code, Message: "login failed: " + d.Message, Path: "/oauth/token/new"}
 	}
-
-	// best-effort parse error body (your old struct has `Error error` which rarely unmarshals nicely)
-	_ = json.Unmarshal(body, &e)
-	return d, fmt.Errorf("token http %d: %s", res.StatusCode, string(body))
+	return d, nil
 }
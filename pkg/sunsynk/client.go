@@ -0,0 +1,169 @@
+package sunsynk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"ssctl/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultBaseURL   = "https://api.sunsynk.net"
+	DefaultUserAgent = "ssctl"
+)
+
+// TokenSource supplies the bearer token used for authenticated API calls.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// invalidator is implemented by token sources that can renew a token the API
+// has rejected.
+type invalidator interface {
+	Invalidate()
+}
+
+// StaticToken is a TokenSource that always returns the same access token.
+type StaticToken string
+
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	if t == "" {
+		return "", fmt.Errorf("no access token configured")
+	}
+	return string(t), nil
+}
+
+// Client talks to a single Sunsynk API deployment. The zero value is not
+// usable; create one with NewClient.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Tokens     TokenSource
+	UserAgent  string
+	Retry      utils.RetryPolicy
+	// PageSize is the page size used when walking listing endpoints.
+	PageSize int
+}
+
+// BaseURLFromEnv returns SS_API_ENDPOINT if set, otherwise DefaultBaseURL.
+func BaseURLFromEnv() string {
+	if v := os.Getenv("SS_API_ENDPOINT"); v != "" {
+		return v
+	}
+	return DefaultBaseURL
+}
+
+func NewClient(baseURL string, tokens TokenSource) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{
+			Timeout: time.Second * 30,
+		},
+		Tokens:    tokens,
+		UserAgent: DefaultUserAgent,
+		Retry:     utils.DefaultRetryPolicy,
+		PageSize:  DefaultPageSize,
+	}
+}
+
+func (c *Client) endpoint(path string, query url.Values) string {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do sends a request and returns the raw response body. Authenticated
+// requests pull a bearer token from the client's TokenSource, and are sent
+// once more with a renewed token if the API rejects it. Transient failures
+// are retried according to c.Retry and the request is abandoned as soon as
+// ctx is cancelled.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, authenticated bool) ([]byte, error) {
+
+	respBody, err := c.send(ctx, method, path, query, body, authenticated)
+
+	if authenticated && IsUnauthorized(err) {
+		if tokens, ok := c.Tokens.(invalidator); ok {
+			tokens.Invalidate()
+			respBody, err = c.send(ctx, method, path, query, body, authenticated)
+		}
+	}
+
+	return respBody, err
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body []byte, authenticated bool) ([]byte, error) {
+
+	var token string
+	if authenticated {
+		if c.Tokens == nil {
+			return nil, fmt.Errorf("no token source configured")
+		}
+		var err error
+		token, err = c.Tokens.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, c.endpoint(path, query), bytes.NewBuffer(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		if c.UserAgent != "" {
+			req.Header.Set("User-Agent", c.UserAgent)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		return req, nil
+	}
+
+	respBody, err := c.Retry.Do(ctx, c.HTTPClient, newRequest)
+	if err != nil {
+		var statusErr *utils.HTTPStatusError
+		if errors.As(err, &statusErr) {
+			return nil, apiErrorFromStatus(path, statusErr)
+		}
+		return nil, err
+	}
+
+	if os.Getenv("SS_DEBUG") == "TRUE" {
+		log.Debug(string(respBody))
+	}
+
+	if err := checkEnvelope(path, respBody); err != nil {
+		return nil, err
+	}
+
+	return respBody, nil
+}
+
+// get performs an authenticated GET and decodes the JSON response into out.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+
+	body, err := c.do(ctx, "GET", path, query, nil, true)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,112 @@
+package sunsynk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ssctl/pkg/utils"
+)
+
+// APIError is returned for any call the Sunsynk API rejects, either with a
+// non-2xx status or with a 200 whose envelope has success=false.
+type APIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+	Path       string
+	RequestID  string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("sunsynk api %s: status %d code %d", e.Path, e.StatusCode, e.Code)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += " (request id " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// IsUnauthorized reports whether err means the access token was missing,
+// expired or rejected.
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusUnauthorized || apiErr.Code == http.StatusUnauthorized {
+		return true
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return strings.Contains(msg, "token") && (strings.Contains(msg, "expired") || strings.Contains(msg, "invalid"))
+}
+
+// IsRateLimited reports whether err means the API is throttling requests.
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.Code == http.StatusTooManyRequests
+}
+
+// envelope is the code/msg/success wrapper shared by every API response.
+type envelope struct {
+	Code    int    `json:"code"`
+	Message string `json:"msg"`
+	Success *bool  `json:"success"`
+}
+
+// checkEnvelope turns a 200 response with success=false into an APIError.
+func checkEnvelope(path string, body []byte) error {
+
+	// Bodies that are not an envelope are left for the caller to decode.
+	var e envelope
+	if json.Unmarshal(body, &e) != nil {
+		return nil
+	}
+
+	if e.Success != nil && !*e.Success {
+		return &APIError{
+			StatusCode: http.StatusOK,
+			Code:       e.Code,
+			Message:    e.Message,
+			Path:       path,
+		}
+	}
+
+	return nil
+}
+
+// apiErrorFromStatus decodes the body of a non-2xx response into an APIError.
+// Both the Spring style error body and the regular envelope are understood.
+func apiErrorFromStatus(path string, statusErr *utils.HTTPStatusError) *APIError {
+
+	apiErr := &APIError{
+		StatusCode: statusErr.StatusCode,
+		Path:       path,
+		RequestID:  statusErr.Header.Get("X-Request-Id"),
+	}
+
+	var e SSApiErrorResponse
+	if json.Unmarshal(statusErr.Body, &e) == nil {
+		apiErr.Code = e.Code
+		apiErr.Message = e.Message
+		if apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(e.Error + " " + e.ErrorDescription)
+		}
+		if e.Path != "" {
+			apiErr.Path = e.Path
+		}
+	}
+
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(statusErr.StatusCode)
+	}
+
+	return apiErr
+}
@@ -0,0 +1,168 @@
+package sunsynk
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"ssctl/pkg/utils"
+)
+
+func TestCheckEnvelope(t *testing.T) {
+
+	tests := []struct {
+		name string
+		body string
+		want *APIError
+	}{
+		{name: "success", body: `{"code":0,"msg":"Success","success":true,"data":{}}`},
+		{name: "no success field", body: `{"code":0,"data":[]}`},
+		{name: "not json", body: `<html>ok</html>`},
+		{name: "json array", body: `[1,2]`},
+		{
+			name: "failure",
+			body: `{"code":102,"msg":"Plant not found","success":false}`,
+			want: &APIError{StatusCode: 200, Code: 102, Message: "Plant not found", Path: "/api/v1/plant/1"},
+		},
+		{
+			name: "expired token",
+			body: `{"code":401,"msg":"Token expired","success":false}`,
+			want: &APIError{StatusCode: 200, Code: 401, Message: "Token expired", Path: "/api/v1/plant/1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			err := checkEnvelope("/api/v1/plant/1", []byte(tt.body))
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an APIError", err)
+			}
+			if *apiErr != *tt.want {
+				t.Errorf("got %+v, want %+v", *apiErr, *tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrorFromStatus(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		want   APIError
+	}{
+		{
+			name:   "spring error body",
+			status: 401,
+			body:   `{"timestamp":"2024-01-01T00:00:00.000+00:00","status":401,"error":"Unauthorized","path":"/api/v1/user"}`,
+			want:   APIError{StatusCode: 401, Message: "Unauthorized", Path: "/api/v1/user"},
+		},
+		{
+			name:   "oauth error body",
+			status: 400,
+			body:   `{"error":"invalid_grant","error_description":"Invalid refresh token"}`,
+			want:   APIError{StatusCode: 400, Message: "invalid_grant Invalid refresh token", Path: "/oauth/token/new"},
+		},
+		{
+			name:   "envelope body",
+			status: 500,
+			body:   `{"code":500,"msg":"Internal error","success":false}`,
+			want:   APIError{StatusCode: 500, Code: 500, Message: "Internal error", Path: "/oauth/token/new"},
+		},
+		{
+			name:   "non-json body",
+			status: 502,
+			body:   `<html>Bad Gateway</html>`,
+			want:   APIError{StatusCode: 502, Message: "Bad Gateway", Path: "/oauth/token/new"},
+		},
+		{
+			name:   "empty body",
+			status: 429,
+			want:   APIError{StatusCode: 429, Message: "Too Many Requests", Path: "/oauth/token/new"},
+		},
+		{
+			name:   "request id",
+			status: 503,
+			header: http.Header{"X-Request-Id": []string{"abc-123"}},
+			body:   `{"code":503,"msg":"Busy"}`,
+			want:   APIError{StatusCode: 503, Code: 503, Message: "Busy", Path: "/oauth/token/new", RequestID: "abc-123"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+
+			got := apiErrorFromStatus("/oauth/token/new", &utils.HTTPStatusError{
+				Method:     "POST",
+				URL:        "https://api.sunsynk.net/oauth/token/new",
+				StatusCode: tt.status,
+				Header:     header,
+				Body:       []byte(tt.body),
+			})
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+
+	err := &APIError{StatusCode: 503, Code: 503, Message: "Busy", Path: "/api/v1/user", RequestID: "abc-123"}
+
+	want := "sunsynk api /api/v1/user: status 503 code 503: Busy (request id abc-123)"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		err          error
+		unauthorized bool
+		rateLimited  bool
+	}{
+		{name: "401 status", err: &APIError{StatusCode: 401}, unauthorized: true},
+		{name: "401 code", err: &APIError{StatusCode: 200, Code: 401}, unauthorized: true},
+		{name: "token expired message", err: &APIError{StatusCode: 200, Code: 1, Message: "Token Expired"}, unauthorized: true},
+		{name: "invalid token message", err: &APIError{StatusCode: 400, Message: "invalid access token"}, unauthorized: true},
+		{name: "other token message", err: &APIError{StatusCode: 200, Message: "token saved"}},
+		{name: "429 status", err: &APIError{StatusCode: 429}, rateLimited: true},
+		{name: "429 code", err: &APIError{StatusCode: 200, Code: 429}, rateLimited: true},
+		{name: "wrapped", err: fmt.Errorf("plant 1: %w", &APIError{StatusCode: 401}), unauthorized: true},
+		{name: "server error", err: &APIError{StatusCode: 500, Message: "Internal Server Error"}},
+		{name: "not an APIError", err: errors.New("401 token expired")},
+		{name: "nil", err: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got := IsUnauthorized(tt.err); got != tt.unauthorized {
+				t.Errorf("IsUnauthorized = %v, want %v", got, tt.unauthorized)
+			}
+			if got := IsRateLimited(tt.err); got != tt.rateLimited {
+				t.Errorf("IsRateLimited = %v, want %v", got, tt.rateLimited)
+			}
+		})
+	}
+}
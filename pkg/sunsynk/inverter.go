@@ -1,11 +1,8 @@
 package sunsynk
 
 import (
-	"ssctl/pkg/utils"
-)
-
-var (
-	SSAPIInverterEndpoint = "https://api.sunsynk.net/api/v1/inverter/"
+	"context"
+	"net/url"
 )
 
 type SSApiInverterGridRealtimeData struct {
@@ -33,53 +30,209 @@ type SSApiInverterGridRealtimeDataResponse struct {
 	Success bool                          `json:"success"`
 }
 
-func GetInverterGridRealtimeData(inverterid, token string) ([]byte, error) {
+// GetInverterGridRealtimeData returns the live grid meter readings for an inverter.
+func (c *Client) GetInverterGridRealtimeData(ctx context.Context, inverterid string) (SSApiInverterGridRealtimeDataResponse, error) {
 
-	url := SSAPIInverterEndpoint + "grid/" + inverterid + "/realtime"
+	var d SSApiInverterGridRealtimeDataResponse
+	err := c.get(ctx, "/api/v1/inverter/grid/"+inverterid+"/realtime", nil, &d)
+	return d, err
+}
 
-	headers := map[string]string{
-		"Content-Type": "application/json",
-	}
-	body := []byte{}
-	respBody, err := utils.SendHTTPRequest("GET", url, headers, body, token)
-	if err != nil {
-		return respBody, err
-	}
+type SSApiInverterPVString struct {
+	Id      int    `json:"id"`
+	PvNo    int    `json:"pvNo"`
+	Vpv     Float  `json:"vpv"`
+	Ipv     Float  `json:"ipv"`
+	Ppv     Float  `json:"ppv"`
+	TodayPv Float  `json:"todayPv"`
+	Sn      string `json:"sn"`
+	Time    string `json:"time"`
+}
 
-	return respBody, err
+type SSApiInverterInputRealtimeData struct {
+	Pac          int                     `json:"pac"`
+	GridTipPower any                     `json:"grid_tip_power"`
+	PvIV         []SSApiInverterPVString `json:"pvIV"`
+	Etoday       float64                 `json:"etoday"`
+	Etotal       float64                 `json:"etotal"`
+}
 
+type SSApiInverterInputRealtimeDataResponse struct {
+	Code    int                            `json:"code"`
+	Message string                         `json:"msg"`
+	Data    SSApiInverterInputRealtimeData `json:"data"`
+	Success bool                           `json:"success"`
 }
 
-func GetInverterData(date, inverterid, column, token string) ([]byte, error) {
+// GetInverterInputRealtimeData returns the live PV readings of an inverter,
+// with voltage, current and power per MPPT.
+func (c *Client) GetInverterInputRealtimeData(ctx context.Context, inverterid string) (SSApiInverterInputRealtimeDataResponse, error) {
 
-	url := SSAPIInverterEndpoint + "/energy/" + inverterid + "/input/day?lan=en&date=" + date + "&column=" + column
+	var d SSApiInverterInputRealtimeDataResponse
+	err := c.get(ctx, "/api/v1/inverter/"+inverterid+"/realtime/input", nil, &d)
+	return d, err
+}
 
-	headers := map[string]string{
-		"Content-Type": "application/json",
-	}
-	body := []byte{}
-	respBody, err := utils.SendHTTPRequest("GET", url, headers, body, token)
-	if err != nil {
-		return respBody, err
-	}
+// SSApiInverterPhase is the reading of one phase of an inverter output,
+// load or grid connection.
+type SSApiInverterPhase struct {
+	Volt    Float `json:"volt"`
+	Current Float `json:"current"`
+	Power   Float `json:"power"`
+}
 
-	return respBody, err
+type SSApiInverterBatteryRealtimeData struct {
+	Time                  string `json:"time"`
+	Status                int    `json:"status"`
+	Type                  int    `json:"type"`
+	Soc                   Float  `json:"soc"`
+	Voltage               Float  `json:"voltage"`
+	Current               Float  `json:"current"`
+	Power                 Float  `json:"power"`
+	Temp                  Float  `json:"temp"`
+	Capacity              Float  `json:"capacity"`
+	CorrectCap            Float  `json:"correctCap"`
+	BmsSoc                Float  `json:"bmsSoc"`
+	BmsVolt               Float  `json:"bmsVolt"`
+	BmsCurrent            Float  `json:"bmsCurrent"`
+	BmsTemp               Float  `json:"bmsTemp"`
+	ChargeVolt            Float  `json:"chargeVolt"`
+	DischargeVolt         Float  `json:"dischargeVolt"`
+	ChargeCurrentLimit    Float  `json:"chargeCurrentLimit"`
+	DischargeCurrentLimit Float  `json:"dischargeCurrentLimit"`
+	EtodayChg             Float  `json:"etodayChg"`
+	EtodayDischg          Float  `json:"etodayDischg"`
+	EtotalChg             Float  `json:"etotalChg"`
+	EtotalDischg          Float  `json:"etotalDischg"`
+}
 
+type SSApiInverterBatteryRealtimeDataResponse struct {
+	Code    int                              `json:"code"`
+	Message string                           `json:"msg"`
+	Data    SSApiInverterBatteryRealtimeData `json:"data"`
+	Success bool                             `json:"success"`
 }
 
-func GetCustomInverterData(date, edate, inverterid, params, token string) ([]byte, error) {
+// GetInverterBatteryRealtimeData returns the live battery readings of an
+// inverter, as seen by the inverter and by the BMS.
+func (c *Client) GetInverterBatteryRealtimeData(ctx context.Context, inverterid string) (SSApiInverterBatteryRealtimeDataResponse, error) {
 
-	url := SSAPIInverterEndpoint + inverterid + "/input/day?lan=en&date=" + date + "&edate=" + edate + "&params=" + params
+	query := url.Values{}
+	query.Set("sn", inverterid)
+	query.Set("lan", "en")
 
-	headers := map[string]string{
-		"Content-Type": "application/json",
-	}
-	body := []byte{}
-	respBody, err := utils.SendHTTPRequest("GET", url, headers, body, token)
-	if err != nil {
-		return respBody, err
-	}
+	var d SSApiInverterBatteryRealtimeDataResponse
+	err := c.get(ctx, "/api/v1/inverter/battery/"+inverterid+"/realtime", query, &d)
+	return d, err
+}
+
+type SSApiInverterLoadRealtimeData struct {
+	TotalPower      Float                `json:"totalPower"`
+	DailyUsed       Float                `json:"dailyUsed"`
+	TotalUsed       Float                `json:"totalUsed"`
+	SmartLoadStatus int                  `json:"smartLoadStatus"`
+	UpsPowerL1      Float                `json:"upsPowerL1"`
+	UpsPowerL2      Float                `json:"upsPowerL2"`
+	UpsPowerL3      Float                `json:"upsPowerL3"`
+	UpsPowerTotal   Float                `json:"upsPowerTotal"`
+	Pf              Float                `json:"pf"`
+	LoadFac         Float                `json:"loadFac"`
+	Vip             []SSApiInverterPhase `json:"vip"`
+}
+
+type SSApiInverterLoadRealtimeDataResponse struct {
+	Code    int                           `json:"code"`
+	Message string                        `json:"msg"`
+	Data    SSApiInverterLoadRealtimeData `json:"data"`
+	Success bool                          `json:"success"`
+}
+
+// GetInverterLoadRealtimeData returns the live consumption of the loads
+// connected to an inverter.
+func (c *Client) GetInverterLoadRealtimeData(ctx context.Context, inverterid string) (SSApiInverterLoadRealtimeDataResponse, error) {
+
+	query := url.Values{}
+	query.Set("sn", inverterid)
+
+	var d SSApiInverterLoadRealtimeDataResponse
+	err := c.get(ctx, "/api/v1/inverter/load/"+inverterid+"/realtime", query, &d)
+	return d, err
+}
+
+type SSApiInverterOutputRealtimeData struct {
+	PInv Float                `json:"pInv"`
+	Pac  Float                `json:"pac"`
+	Fac  Float                `json:"fac"`
+	Vip  []SSApiInverterPhase `json:"vip"`
+}
+
+type SSApiInverterOutputRealtimeDataResponse struct {
+	Code    int                             `json:"code"`
+	Message string                          `json:"msg"`
+	Data    SSApiInverterOutputRealtimeData `json:"data"`
+	Success bool                            `json:"success"`
+}
+
+// GetInverterOutputRealtimeData returns the live AC output of an inverter.
+func (c *Client) GetInverterOutputRealtimeData(ctx context.Context, inverterid string) (SSApiInverterOutputRealtimeDataResponse, error) {
+
+	var d SSApiInverterOutputRealtimeDataResponse
+	err := c.get(ctx, "/api/v1/inverter/"+inverterid+"/realtime/output", nil, &d)
+	return d, err
+}
+
+// InverterTemperatureColumns are the output day chart columns holding the
+// DC (battery side) and AC (IGBT) temperatures.
+const InverterTemperatureColumns = "dc_temp,igbt_temp"
+
+type SSApiInverterDayDataResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"msg"`
+	Data    struct {
+		Infos []SSApiPlantData `json:"infos"`
+	} `json:"data"`
+	Success bool `json:"success"`
+}
+
+// GetInverterOutputDayData returns the output day chart of an inverter for
+// the given comma separated columns, e.g. InverterTemperatureColumns.
+func (c *Client) GetInverterOutputDayData(ctx context.Context, date, inverterid, columns string) (SSApiInverterDayDataResponse, error) {
+
+	query := url.Values{}
+	query.Set("lan", "en")
+	query.Set("date", date)
+	query.Set("column", columns)
+
+	var d SSApiInverterDayDataResponse
+	err := c.get(ctx, "/api/v1/inverter/"+inverterid+"/output/day", query, &d)
+	return d, err
+}
+
+// GetInverterData returns the day chart of an inverter for the given comma
+// separated columns, e.g. pac or etoday.
+func (c *Client) GetInverterData(ctx context.Context, date, inverterid, column string) (SSApiInverterDayDataResponse, error) {
+
+	query := url.Values{}
+	query.Set("lan", "en")
+	query.Set("date", date)
+	query.Set("column", column)
+
+	var d SSApiInverterDayDataResponse
+	err := c.get(ctx, "/api/v1/inverter/energy/"+inverterid+"/input/day", query, &d)
+	return d, err
+}
+
+// GetCustomInverterData returns the chart of an inverter for the given comma
+// separated params from date to edate.
+func (c *Client) GetCustomInverterData(ctx context.Context, date, edate, inverterid, params string) (SSApiInverterDayDataResponse, error) {
 
-	return respBody, err
+	query := url.Values{}
+	query.Set("lan", "en")
+	query.Set("date", date)
+	query.Set("edate", edate)
+	query.Set("params", params)
 
+	var d SSApiInverterDayDataResponse
+	err := c.get(ctx, "/api/v1/inverter/"+inverterid+"/input/day", query, &d)
+	return d, err
 }
@@ -0,0 +1,31 @@
+package sunsynk
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// Float is a number the API sends either as a JSON number or as a string,
+// depending on the endpoint and firmware. Null, empty and "--" read as 0.
+type Float float64
+
+func (f *Float) UnmarshalJSON(data []byte) error {
+
+	data = bytes.Trim(data, `"`)
+
+	switch string(data) {
+	case "null", "", "--":
+		*f = 0
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", data)
+	}
+
+	*f = Float(v)
+
+	return nil
+}
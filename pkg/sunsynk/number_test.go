@@ -0,0 +1,51 @@
+package sunsynk
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFloat(t *testing.T) {
+
+	tests := []struct {
+		json    string
+		want    Float
+		wantErr bool
+	}{
+		{`1.5`, 1.5, false},
+		{`"345.6"`, 345.6, false},
+		{`-2`, -2, false},
+		{`""`, 0, false},
+		{`"--"`, 0, false},
+		{`null`, 0, false},
+		{`"n/a"`, 0, true},
+	}
+
+	for _, tt := range tests {
+
+		var f Float
+		err := json.Unmarshal([]byte(tt.json), &f)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.json, err, tt.wantErr)
+			continue
+		}
+		if f != tt.want {
+			t.Errorf("%s = %v, want %v", tt.json, f, tt.want)
+		}
+	}
+}
+
+func TestPVStringIdle(t *testing.T) {
+
+	// An MPPT without sun reports blanks instead of numbers.
+	data := `{"pvNo":2,"vpv":"--","ipv":"","ppv":null,"todayPv":"1.2"}`
+
+	var pv SSApiInverterPVString
+	if err := json.Unmarshal([]byte(data), &pv); err != nil {
+		t.Fatal(err)
+	}
+
+	if pv.Vpv != 0 || pv.Ipv != 0 || pv.Ppv != 0 || pv.TodayPv != 1.2 {
+		t.Errorf("got %+v", pv)
+	}
+}
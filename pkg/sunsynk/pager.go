@@ -0,0 +1,109 @@
+package sunsynk
+
+import (
+	"context"
+)
+
+// DefaultPageSize is the number of items requested per page by the listing
+// iterators when Client.PageSize is not set.
+const DefaultPageSize = 50
+
+// PageFunc fetches one page (numbered from 1) of a listing endpoint and
+// returns its items together with the total number of items reported by
+// the API, or 0 when the API does not report one.
+type PageFunc[T any] func(ctx context.Context, page, limit int) (items []T, total int, err error)
+
+// Iterator walks every page of a listing endpoint:
+//
+//	it := client.Plants()
+//	for it.Next(ctx) {
+//		plant := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	fetch    PageFunc[T]
+	pageSize int
+
+	page  int
+	buf   []T
+	seen  int
+	total int
+	done  bool
+	cur   T
+	err   error
+}
+
+func NewIterator[T any](pageSize int, fetch PageFunc[T]) *Iterator[T] {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &Iterator[T]{fetch: fetch, pageSize: pageSize, total: -1}
+}
+
+// Next advances to the next item, fetching the next page when the current
+// one is exhausted. It returns false at the end or on error.
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+
+	for len(it.buf) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+
+		it.page++
+		items, total, err := it.fetch(ctx, it.page, it.pageSize)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.buf = items
+		it.total = total
+
+		// Stop once the reported total has been reached. The server may
+		// cap the page size below the one asked for, so a short page only
+		// ends the listing when there is no total to go by.
+		switch {
+		case len(items) == 0:
+			it.done = true
+		case total > 0:
+			it.done = it.seen+len(items) >= total
+		default:
+			it.done = len(items) < it.pageSize
+		}
+	}
+
+	it.cur = it.buf[0]
+	it.buf = it.buf[1:]
+	it.seen++
+
+	return true
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	return it.cur
+}
+
+// Err returns the first error encountered while fetching pages.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Total returns the item count reported by the API, or -1 before the first
+// page has been fetched.
+func (it *Iterator[T]) Total() int {
+	return it.total
+}
+
+// Collect drains the iterator into a slice.
+func Collect[T any](ctx context.Context, it *Iterator[T]) ([]T, error) {
+
+	var items []T
+	for it.Next(ctx) {
+		items = append(items, it.Value())
+	}
+
+	return items, it.Err()
+}
@@ -0,0 +1,105 @@
+package sunsynk
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// pages serves n items numbered from 1, at most limit per page but never
+// more than serverCap, reporting total as the item count when withTotal is
+// set.
+func pages(n, serverCap int, withTotal bool, calls *int) PageFunc[int] {
+
+	return func(ctx context.Context, page, limit int) ([]int, int, error) {
+
+		*calls++
+
+		if serverCap > 0 && limit > serverCap {
+			limit = serverCap
+		}
+
+		var items []int
+		for i := (page-1)*limit + 1; i <= n && i <= page*limit; i++ {
+			items = append(items, i)
+		}
+
+		total := 0
+		if withTotal {
+			total = n
+		}
+
+		return items, total, nil
+	}
+}
+
+func TestIterator(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		items     int
+		pageSize  int
+		serverCap int
+		withTotal bool
+		wantCalls int
+	}{
+		{"empty", 0, 10, 0, true, 1},
+		{"single short page", 3, 10, 0, true, 1},
+		{"exact page", 10, 10, 0, true, 1},
+		{"several pages", 25, 10, 0, true, 3},
+		{"server caps page size", 25, 10, 4, true, 7},
+		{"no total, short last page", 25, 10, 0, false, 3},
+		{"no total, exact pages", 20, 10, 0, false, 3},
+		{"default page size", 60, 0, 0, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			calls := 0
+			got, err := Collect(context.Background(), NewIterator(tt.pageSize, pages(tt.items, tt.serverCap, tt.withTotal, &calls)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want []int
+			for i := 1; i <= tt.items; i++ {
+				want = append(want, i)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("items = %v, want %v", got, want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("fetched %d pages, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIteratorError(t *testing.T) {
+
+	failure := errors.New("boom")
+
+	it := NewIterator(2, func(ctx context.Context, page, limit int) ([]int, int, error) {
+		if page == 2 {
+			return nil, 0, failure
+		}
+		return []int{1, 2}, 5, nil
+	})
+
+	got, err := Collect(context.Background(), it)
+	if !errors.Is(err, failure) {
+		t.Errorf("err = %v, want %v", err, failure)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("items = %v, want the first page", got)
+	}
+	if it.Next(context.Background()) {
+		t.Error("Next after an error returned true")
+	}
+	if it.Total() != 5 {
+		t.Errorf("Total = %d, want 5", it.Total())
+	}
+}
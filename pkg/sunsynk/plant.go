@@ -1,25 +1,26 @@
 package sunsynk
 
 import (
-	"ssctl/pkg/utils"
+	"context"
+	"net/url"
+	"strconv"
 	"time"
 )
 
-var (
-	SSApiPlantEndpoint = "https://api.sunsynk.net/api/v1/plant/"
-)
-
 type SSApiPlantData struct {
-	Unit    string `json:"unit"`
-	Records []struct {
-		Time       string `json:"time"`
-		Value      string `json:"value"`
-		UpdateTime string `json:"updateTime"`
-	} `json:"records"`
-	Id        string `json:"id"`
-	Label     string `json:"label"`
-	GroupCode string `json:"groupCode"`
-	Name      string `json:"name"`
+	Unit      string             `json:"unit"`
+	Records   []SSApiPlantRecord `json:"records"`
+	Id        string             `json:"id"`
+	Label     string             `json:"label"`
+	GroupCode string             `json:"groupCode"`
+	Name      string             `json:"name"`
+}
+
+// SSApiPlantRecord is one point of a chart series.
+type SSApiPlantRecord struct {
+	Time       string `json:"time"`
+	Value      string `json:"value"`
+	UpdateTime string `json:"updateTime"`
 }
 
 type SSApiPlantDataResponse struct {
@@ -32,6 +33,35 @@ type SSApiPlantDataResponse struct {
 	Success bool `json:"success"`
 }
 
+type SSApiPlantInfo struct {
+	Id         int     `json:"id"`
+	Name       string  `json:"name"`
+	TotalPower float64 `json:"totalPower"`
+	Address    string  `json:"address"`
+	Lat        float64 `json:"lat"`
+	Lon        float64 `json:"lon"`
+	Currency   struct {
+		Id   int    `json:"id"`
+		Code string `json:"code"`
+		Text string `json:"text"`
+	} `json:"currency"`
+	Timezone struct {
+		Id   int    `json:"id"`
+		Code string `json:"code"`
+		Name string `json:"name"`
+	} `json:"timezone"`
+	CreateAt string `json:"createAt"`
+	Type     int    `json:"type"`
+	Status   int    `json:"status"`
+}
+
+type SSApiPlantInfoResponse struct {
+	Code    int            `json:"code"`
+	Message string         `json:"msg"`
+	Data    SSApiPlantInfo `json:"data"`
+	Success bool           `json:"success"`
+}
+
 type SSApiPlantInverterData struct {
 	Sn           string `json:"sn"`
 	Alias        string `json:"alias"`
@@ -85,36 +115,159 @@ type SSApiPlantInverterDataResponse struct {
 	Success bool `json:"success"`
 }
 
-func GetInverterId(plantid, token string) ([]byte, error) {
+// GetInvertersPage fetches one page of the inverters attached to a plant.
+func (c *Client) GetInvertersPage(ctx context.Context, plantid string, page, limit int) (SSApiPlantInverterDataResponse, error) {
 
-	url := SSApiPlantEndpoint + plantid + "/inverters?page=1&limit=10&status=-1&type=-2"
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("status", "-1")
+	query.Set("type", "-2")
 
-	headers := map[string]string{
-		"Content-Type": "application/json",
-	}
-	body := []byte{}
-	respBody, err := utils.SendHTTPRequest("GET", url, headers, body, token)
+	var d SSApiPlantInverterDataResponse
+	err := c.get(ctx, "/api/v1/plant/"+plantid+"/inverters", query, &d)
+	return d, err
+}
+
+// Inverters iterates over every inverter attached to a plant.
+func (c *Client) Inverters(plantid string) *Iterator[SSApiPlantInverterData] {
+	return NewIterator(c.PageSize, func(ctx context.Context, page, limit int) ([]SSApiPlantInverterData, int, error) {
+		d, err := c.GetInvertersPage(ctx, plantid, page, limit)
+		return d.Data.Infos, d.Data.Total, err
+	})
+}
+
+// GetInverters lists every inverter attached to a plant, walking all pages.
+// The result looks like a single page holding all inverters.
+func (c *Client) GetInverters(ctx context.Context, plantid string) (SSApiPlantInverterDataResponse, error) {
+
+	var d SSApiPlantInverterDataResponse
+
+	it := NewIterator(c.PageSize, func(ctx context.Context, page, limit int) ([]SSApiPlantInverterData, int, error) {
+		var err error
+		d, err = c.GetInvertersPage(ctx, plantid, page, limit)
+		return d.Data.Infos, d.Data.Total, err
+	})
+
+	infos, err := Collect(ctx, it)
 	if err != nil {
-		return respBody, err
+		return d, err
 	}
 
-	return respBody, err
+	d.Data.Infos = infos
+	d.Data.PageNumber = 1
+	d.Data.PageSize = len(infos)
 
+	return d, nil
 }
 
-func GetPlantData(date, plantid, token string) ([]byte, error) {
+// GetPlantInfo returns the plant's metadata, including its timezone.
+func (c *Client) GetPlantInfo(ctx context.Context, plantid string) (SSApiPlantInfoResponse, error) {
 
-	url := SSApiPlantEndpoint + "energy/" + plantid + "/day?lan=en&date=" + date
+	query := url.Values{}
+	query.Set("lan", "en")
+	query.Set("id", plantid)
 
-	headers := map[string]string{
-		"Content-Type": "application/json",
-	}
-	body := []byte{}
-	respBody, err := utils.SendHTTPRequest("GET", url, headers, body, token)
-	if err != nil {
-		return respBody, err
+	var d SSApiPlantInfoResponse
+	err := c.get(ctx, "/api/v1/plant/"+plantid, query, &d)
+	return d, err
+}
+
+// GetPlantData returns the day chart (PV, load, grid, battery...) for a plant.
+func (c *Client) GetPlantData(ctx context.Context, date, plantid string) (SSApiPlantDataResponse, error) {
+
+	query := url.Values{}
+	query.Set("lan", "en")
+	query.Set("date", date)
+
+	var d SSApiPlantDataResponse
+	err := c.get(ctx, "/api/v1/plant/energy/"+plantid+"/day", query, &d)
+	return d, err
+}
+
+// EnergyPeriod is the span of an energy chart and the size of its records.
+type EnergyPeriod string
+
+const (
+	// EnergyMonth has a record per day of the month, date is 2006-01.
+	EnergyMonth EnergyPeriod = "month"
+	// EnergyYear has a record per month of the year, date is 2006.
+	EnergyYear EnergyPeriod = "year"
+	// EnergyTotal has a record per year since the plant was built, date is
+	// ignored.
+	EnergyTotal EnergyPeriod = "total"
+)
+
+// Valid reports whether p is one of the known periods.
+func (p EnergyPeriod) Valid() bool {
+	return p == EnergyMonth || p == EnergyYear || p == EnergyTotal
+}
+
+// GetPlantEnergy returns the PV, load, import, export, charge and discharge
+// energy of a plant over a period, aggregated by the API.
+func (c *Client) GetPlantEnergy(ctx context.Context, period EnergyPeriod, date, plantid string) (SSApiPlantDataResponse, error) {
+
+	query := url.Values{}
+	query.Set("lan", "en")
+	query.Set("id", plantid)
+	if period != EnergyTotal {
+		query.Set("date", date)
 	}
 
-	return respBody, err
+	var d SSApiPlantDataResponse
+	err := c.get(ctx, "/api/v1/plant/energy/"+plantid+"/"+string(period), query, &d)
+	return d, err
+}
+
+// SSApiPlantFlowData is the power flow diagram of a plant. Powers are in W;
+// the boolean fields give the direction of each flow, e.g. ToBat when the
+// battery is charging and BatTo when it is discharging.
+type SSApiPlantFlowData struct {
+	CustCode         int   `json:"custCode"`
+	MeterCode        int   `json:"meterCode"`
+	PvPower          Float `json:"pvPower"`
+	BattPower        Float `json:"battPower"`
+	GridOrMeterPower Float `json:"gridOrMeterPower"`
+	LoadOrEpsPower   Float `json:"loadOrEpsPower"`
+	GenPower         Float `json:"genPower"`
+	MinPower         Float `json:"minPower"`
+	Soc              Float `json:"soc"`
+	SmartLoadPower   Float `json:"smartLoadPower"`
+	UpsLoadPower     Float `json:"upsLoadPower"`
+	HomeLoadPower    Float `json:"homeLoadPower"`
+	PvTo             bool  `json:"pvTo"`
+	ToLoad           bool  `json:"toLoad"`
+	ToSmartLoad      bool  `json:"toSmartLoad"`
+	ToUpsLoad        bool  `json:"toUpsLoad"`
+	ToHomeLoad       bool  `json:"toHomeLoad"`
+	ToGrid           bool  `json:"toGrid"`
+	ToBat            bool  `json:"toBat"`
+	BatTo            bool  `json:"batTo"`
+	GridTo           bool  `json:"gridTo"`
+	GenTo            bool  `json:"genTo"`
+	MinTo            bool  `json:"minTo"`
+	ExistsGen        bool  `json:"existsGen"`
+	ExistsMin        bool  `json:"existsMin"`
+	ExistsMeter      bool  `json:"existsMeter"`
+	GenOn            bool  `json:"genOn"`
+	MicroOn          bool  `json:"microOn"`
+}
+
+type SSApiPlantFlowDataResponse struct {
+	Code    int                `json:"code"`
+	Message string             `json:"msg"`
+	Data    SSApiPlantFlowData `json:"data"`
+	Success bool               `json:"success"`
+}
+
+// GetPlantFlow returns the current power flow of a plant, as shown on the
+// flow diagram of the web UI.
+func (c *Client) GetPlantFlow(ctx context.Context, date, plantid string) (SSApiPlantFlowDataResponse, error) {
+
+	query := url.Values{}
+	query.Set("date", date)
 
+	var d SSApiPlantFlowDataResponse
+	err := c.get(ctx, "/api/v1/plant/energy/"+plantid+"/flow", query, &d)
+	return d, err
 }
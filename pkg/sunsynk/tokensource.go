@@ -0,0 +1,282 @@
+package sunsynk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SSAuthToken is a token as persisted between runs. Timestamp is the unix
+// time the token was issued and TokenExpiry its lifetime in seconds, matching
+// the keys of the sunsynk-token secret.
+type SSAuthToken struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Scope        string
+	TokenExpiry  string
+	Timestamp    string
+}
+
+// NewAuthToken converts a token endpoint response issued at now.
+func NewAuthToken(resp SSApiNewTokenResponse, now time.Time) SSAuthToken {
+	return SSAuthToken{
+		AccessToken:  resp.Data.AccessToken,
+		TokenType:    resp.Data.TokenType,
+		RefreshToken: resp.Data.RefreshToken,
+		Scope:        resp.Data.Scope,
+		TokenExpiry:  fmt.Sprint(resp.Data.TokenExpiry),
+		Timestamp:    fmt.Sprint(now.Unix()),
+	}
+}
+
+// Map returns the token under the keys of the sunsynk-token secret, as
+// stored by the secret backed token stores.
+func (t SSAuthToken) Map() map[string]string {
+	return map[string]string{
+		"token":     t.AccessToken,
+		"type":      t.TokenType,
+		"refresh":   t.RefreshToken,
+		"expiry":    t.TokenExpiry,
+		"scope":     t.Scope,
+		"timestamp": t.Timestamp,
+	}
+}
+
+// TokenFromMap is the reverse of Map.
+func TokenFromMap(m map[string]string) SSAuthToken {
+	return SSAuthToken{
+		AccessToken:  m["token"],
+		TokenType:    m["type"],
+		RefreshToken: m["refresh"],
+		TokenExpiry:  m["expiry"],
+		Scope:        m["scope"],
+		Timestamp:    m["timestamp"],
+	}
+}
+
+// IssuedAt returns when the token was issued. ok is false when the token
+// carries no timestamp.
+func (t SSAuthToken) IssuedAt() (issued time.Time, ok bool) {
+
+	unix, err := strconv.ParseInt(t.Timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(unix, 0), true
+}
+
+// ExpiresAt returns when the access token expires. ok is false when the
+// token does not carry enough information to tell.
+func (t SSAuthToken) ExpiresAt() (expiry time.Time, ok bool) {
+
+	issued, ok := t.IssuedAt()
+	if !ok {
+		return time.Time{}, false
+	}
+
+	lifetime, err := strconv.ParseInt(t.TokenExpiry, 10, 64)
+	if err != nil || lifetime <= 0 {
+		return time.Time{}, false
+	}
+
+	return issued.Add(time.Duration(lifetime) * time.Second), true
+}
+
+// ErrNoToken is returned by a TokenStore that holds no token yet.
+var ErrNoToken = errors.New("no stored token")
+
+// TokenStore persists tokens between runs.
+type TokenStore interface {
+	LoadToken(ctx context.Context) (SSAuthToken, error)
+	SaveToken(ctx context.Context, token SSAuthToken) error
+}
+
+// CredentialStore returns the username and password used for a full login.
+type CredentialStore interface {
+	Credentials(ctx context.Context) (user, pass string, err error)
+}
+
+// CredentialsFunc adapts a function to a CredentialStore.
+type CredentialsFunc func(ctx context.Context) (user, pass string, err error)
+
+func (f CredentialsFunc) Credentials(ctx context.Context) (string, string, error) {
+	return f(ctx)
+}
+
+// DefaultRefreshBefore is how long before expiry a token is refreshed.
+const DefaultRefreshBefore = 10 * time.Minute
+
+// RefreshingTokenSource hands out the stored access token, refreshing it with
+// the refresh_token grant shortly before it expires. A full password login is
+// only attempted when there is no refresh token or the refresh is rejected.
+type RefreshingTokenSource struct {
+	Client *Client
+	// Store may be nil, in which case tokens only live in memory.
+	Store TokenStore
+	// Credentials may be nil, disabling the password login fallback.
+	Credentials   CredentialStore
+	RefreshBefore time.Duration
+
+	mu     sync.Mutex
+	token  SSAuthToken
+	loaded bool
+}
+
+func (s *RefreshingTokenSource) Token(ctx context.Context) (string, error) {
+
+	token, err := s.AuthToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// AuthToken returns the full current token, renewing it first if needed.
+func (s *RefreshingTokenSource) AuthToken(ctx context.Context) (SSAuthToken, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return SSAuthToken{}, err
+	}
+
+	if s.valid(time.Now()) {
+		return s.token, nil
+	}
+
+	return s.renew(ctx)
+}
+
+// Renew fetches a new token regardless of the expiry of the current one.
+func (s *RefreshingTokenSource) Renew(ctx context.Context) (SSAuthToken, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return SSAuthToken{}, err
+	}
+
+	return s.renew(ctx)
+}
+
+// Invalidate discards the current access token after the API rejected it,
+// so the next call to Token renews it.
+func (s *RefreshingTokenSource) Invalidate() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token.AccessToken = ""
+}
+
+// Login performs a full password login, bypassing the refresh token.
+func (s *RefreshingTokenSource) Login(ctx context.Context) (SSAuthToken, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loaded = true
+
+	return s.login(ctx)
+}
+
+func (s *RefreshingTokenSource) load(ctx context.Context) error {
+
+	if s.loaded || s.Store == nil {
+		s.loaded = true
+		return nil
+	}
+
+	token, err := s.Store.LoadToken(ctx)
+	if err != nil && !errors.Is(err, ErrNoToken) {
+		return err
+	}
+
+	s.token = token
+	s.loaded = true
+
+	return nil
+}
+
+func (s *RefreshingTokenSource) valid(now time.Time) bool {
+
+	if s.token.AccessToken == "" {
+		return false
+	}
+
+	expiry, ok := s.token.ExpiresAt()
+	if !ok {
+		// Tokens of unknown age are used until the API rejects them.
+		return true
+	}
+
+	refreshBefore := s.RefreshBefore
+	if refreshBefore == 0 {
+		refreshBefore = DefaultRefreshBefore
+	}
+
+	return now.Add(refreshBefore).Before(expiry)
+}
+
+func (s *RefreshingTokenSource) renew(ctx context.Context) (SSAuthToken, error) {
+
+	if s.token.RefreshToken != "" {
+		resp, err := s.Client.RefreshToken(ctx, s.token.RefreshToken)
+		if err == nil {
+			log.Debug("refreshed sunsynk access token")
+			return s.store(ctx, NewAuthToken(resp, time.Now())), nil
+		}
+		if ctx.Err() != nil {
+			return SSAuthToken{}, err
+		}
+		log.Warnf("token refresh failed, falling back to password login: %v", err)
+	}
+
+	return s.login(ctx)
+}
+
+func (s *RefreshingTokenSource) login(ctx context.Context) (SSAuthToken, error) {
+
+	if s.Credentials == nil {
+		return SSAuthToken{}, fmt.Errorf("access token expired and no credentials available to log in again")
+	}
+
+	user, pass, err := s.Credentials.Credentials(ctx)
+	if err != nil {
+		return SSAuthToken{}, err
+	}
+
+	resp, err := s.Client.Login(ctx, user, pass)
+	if err != nil {
+		return SSAuthToken{}, err
+	}
+
+	log.Debug("logged in to sunsynk with password")
+
+	return s.store(ctx, NewAuthToken(resp, time.Now())), nil
+}
+
+// store makes token the current one and saves it. A token that cannot be
+// saved is still used: it is only lost at the end of the run.
+func (s *RefreshingTokenSource) store(ctx context.Context, token SSAuthToken) SSAuthToken {
+
+	s.token = token
+
+	if s.Store != nil {
+		if err := s.Store.SaveToken(ctx, token); err != nil {
+			log.Warnf("could not save sunsynk token: %v", err)
+		}
+	}
+
+	return token
+}
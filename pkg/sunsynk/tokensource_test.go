@@ -0,0 +1,254 @@
+package sunsynk
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ssctl/pkg/utils"
+)
+
+// fakeAuthAPI is a Sunsynk API serving the token grants and the plant list,
+// which only accepts the access tokens it has issued and not revoked.
+type fakeAuthAPI struct {
+	publicKey string
+
+	mu            sync.Mutex
+	valid         map[string]bool
+	rejectRefresh bool
+	logins        int
+	refreshes     int
+	requests      int
+}
+
+func newFakeAuthAPI(t *testing.T) (*fakeAuthAPI, *Client) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &fakeAuthAPI{
+		publicKey: base64.StdEncoding.EncodeToString(der),
+		valid:     map[string]bool{},
+	}
+
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, nil)
+	client.Retry = utils.RetryPolicy{MaxAttempts: 1}
+
+	return api, client
+}
+
+func (a *fakeAuthAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/anonymous/publicKey":
+		json.NewEncoder(w).Encode(map[string]string{"data": a.publicKey})
+
+	case "/oauth/token/new":
+		var grant struct {
+			GrantType    string `json:"grant_type"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&grant)
+
+		var access string
+		switch {
+		case grant.GrantType == "password":
+			a.logins++
+			access = fmt.Sprintf("login-%d", a.logins)
+		case grant.GrantType == "refresh_token" && !a.rejectRefresh:
+			a.refreshes++
+			access = fmt.Sprintf("refresh-%d", a.refreshes)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Invalid refresh token"}`)
+			return
+		}
+		a.valid[access] = true
+
+		fmt.Fprintf(w, `{"code":0,"msg":"Success","success":true,"data":{"access_token":%q,"token_type":"bearer","refresh_token":"r-%s","expires_in":3600,"scope":"all"}}`, access, access)
+
+	case "/api/v1/plants":
+		a.requests++
+		if !a.valid[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"status":401,"error":"Unauthorized","path":"/api/v1/plants"}`)
+			return
+		}
+		fmt.Fprint(w, `{"code":0,"msg":"Success","success":true,"data":{"total":0,"infos":[]}}`)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// memoryTokenStore is a TokenStore kept in memory, whose saves fail with err.
+type memoryTokenStore struct {
+	token SSAuthToken
+	saves int
+	err   error
+}
+
+func (m *memoryTokenStore) LoadToken(ctx context.Context) (SSAuthToken, error) {
+	if m.token.AccessToken == "" && m.token.RefreshToken == "" {
+		return SSAuthToken{}, ErrNoToken
+	}
+	return m.token, nil
+}
+
+func (m *memoryTokenStore) SaveToken(ctx context.Context, token SSAuthToken) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.token = token
+	m.saves++
+	return nil
+}
+
+func credentials(ctx context.Context) (string, string, error) {
+	return "user", "pass", nil
+}
+
+// issued returns a token issued age ago that lives for an hour.
+func issued(access string, age time.Duration) SSAuthToken {
+	return SSAuthToken{
+		AccessToken:  access,
+		RefreshToken: "r-" + access,
+		TokenExpiry:  "3600",
+		Timestamp:    fmt.Sprint(time.Now().Add(-age).Unix()),
+	}
+}
+
+func TestTokenSourceRenewsBeforeExpiry(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		stored SSAuthToken
+		want   string
+	}{
+		{name: "fresh token used as is", stored: issued("stored", time.Minute), want: "stored"},
+		{name: "token of unknown age used as is", stored: SSAuthToken{AccessToken: "stored"}, want: "stored"},
+		{name: "token close to expiry refreshed", stored: issued("stored", 55*time.Minute), want: "refresh-1"},
+		{name: "expired token refreshed", stored: issued("stored", 2*time.Hour), want: "refresh-1"},
+		{name: "nothing stored logs in", want: "login-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			api, client := newFakeAuthAPI(t)
+			store := &memoryTokenStore{token: tt.stored}
+			source := &RefreshingTokenSource{Client: client, Store: store, Credentials: CredentialsFunc(credentials)}
+
+			token, err := source.Token(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != tt.want {
+				t.Errorf("token = %q, want %q", token, tt.want)
+			}
+
+			renewed := token != tt.stored.AccessToken
+			if renewed && store.token.AccessToken != tt.want {
+				t.Errorf("stored %q, want %q", store.token.AccessToken, tt.want)
+			}
+			if !renewed && api.logins+api.refreshes != 0 {
+				t.Errorf("%d logins and %d refreshes for a fresh token", api.logins, api.refreshes)
+			}
+
+			// The token is kept for the following calls.
+			if again, _ := source.Token(context.Background()); again != token {
+				t.Errorf("second token = %q, want %q", again, token)
+			}
+		})
+	}
+}
+
+func TestTokenSourceFallsBackToLogin(t *testing.T) {
+
+	api, client := newFakeAuthAPI(t)
+	api.rejectRefresh = true
+
+	store := &memoryTokenStore{token: issued("stored", 2*time.Hour)}
+	source := &RefreshingTokenSource{Client: client, Store: store, Credentials: CredentialsFunc(credentials)}
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "login-1" || store.token.AccessToken != "login-1" {
+		t.Errorf("token = %q, stored %q, want login-1", token, store.token.AccessToken)
+	}
+
+	// Without credentials there is nothing to fall back to.
+	source = &RefreshingTokenSource{Client: client, Store: &memoryTokenStore{token: issued("stored", 2*time.Hour)}}
+	if _, err := source.Token(context.Background()); err == nil {
+		t.Error("renewal without credentials did not fail")
+	}
+}
+
+func TestTokenSourceRetriesRejectedToken(t *testing.T) {
+
+	api, client := newFakeAuthAPI(t)
+
+	// The stored token looks fresh but the API no longer accepts it.
+	store := &memoryTokenStore{token: issued("revoked", time.Minute)}
+	client.Tokens = &RefreshingTokenSource{Client: client, Store: store, Credentials: CredentialsFunc(credentials)}
+
+	if _, err := client.GetUserPlantsPage(context.Background(), 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if api.requests != 2 || api.refreshes != 1 {
+		t.Errorf("%d requests and %d refreshes, want 2 and 1", api.requests, api.refreshes)
+	}
+	if store.token.AccessToken != "refresh-1" {
+		t.Errorf("stored %q, want refresh-1", store.token.AccessToken)
+	}
+
+	// A token that is rejected again is not retried a second time.
+	api.valid["refresh-1"] = false
+	api.rejectRefresh = true
+	client.Tokens = &RefreshingTokenSource{Client: client, Store: &memoryTokenStore{token: issued("revoked", time.Minute)}}
+
+	_, err := client.GetUserPlantsPage(context.Background(), 1, 10)
+	if err == nil {
+		t.Fatal("request with no usable token did not fail")
+	}
+}
+
+func TestTokenSourceSaveFailure(t *testing.T) {
+
+	_, client := newFakeAuthAPI(t)
+	store := &memoryTokenStore{err: errors.New("read-only file system")}
+	source := &RefreshingTokenSource{Client: client, Store: store, Credentials: CredentialsFunc(credentials)}
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token failed when the token could not be saved: %v", err)
+	}
+	if token != "login-1" {
+		t.Errorf("token = %q, want login-1", token)
+	}
+}
@@ -1,22 +1,11 @@
 package sunsynk
 
 import (
-	"ssctl/pkg/utils"
+	"context"
+	"net/url"
+	"strconv"
 )
 
-var (
-	SSApiListPlantsEndpoint = "https://api.sunsynk.net/api/v1/plants?page=1&limit=10"
-)
-
-type SSAuthToken struct {
-	AccessToken  string
-	TokenType    string
-	RefreshToken string
-	Scope        string
-	TokenExpiry  string
-	Timestamp    string
-}
-
 type SSApiUserPlant struct {
 	Id   int    `json:"id"`
 	Name string `json:"name"`
@@ -26,23 +15,55 @@ type SSApiUserPlantsResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"msg"`
 	Data    struct {
-		Total int              `json:"total"`
-		Infos []SSApiUserPlant `json:"infos"`
+		PageSize   int              `json:"pageSize"`
+		PageNumber int              `json:"pageNumber"`
+		Total      int              `json:"total"`
+		Infos      []SSApiUserPlant `json:"infos"`
 	} `json:"data"`
 	Success bool `json:"success"`
 }
 
-func GetUserData(url, token string) ([]byte, error) {
+// GetUserPlantsPage fetches one page of the plants visible to the
+// authenticated user.
+func (c *Client) GetUserPlantsPage(ctx context.Context, page, limit int) (SSApiUserPlantsResponse, error) {
 
-	headers := map[string]string{
-		"Content-Type": "application/json",
-	}
-	body := []byte{}
-	respBody, err := utils.SendHTTPRequest("GET", url, headers, body, token)
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var d SSApiUserPlantsResponse
+	err := c.get(ctx, "/api/v1/plants", query, &d)
+	return d, err
+}
+
+// Plants iterates over every plant visible to the authenticated user.
+func (c *Client) Plants() *Iterator[SSApiUserPlant] {
+	return NewIterator(c.PageSize, func(ctx context.Context, page, limit int) ([]SSApiUserPlant, int, error) {
+		d, err := c.GetUserPlantsPage(ctx, page, limit)
+		return d.Data.Infos, d.Data.Total, err
+	})
+}
+
+// GetUserPlants lists every plant visible to the authenticated user, walking
+// all pages. The result looks like a single page holding all plants.
+func (c *Client) GetUserPlants(ctx context.Context) (SSApiUserPlantsResponse, error) {
+
+	var d SSApiUserPlantsResponse
+
+	it := NewIterator(c.PageSize, func(ctx context.Context, page, limit int) ([]SSApiUserPlant, int, error) {
+		var err error
+		d, err = c.GetUserPlantsPage(ctx, page, limit)
+		return d.Data.Infos, d.Data.Total, err
+	})
+
+	infos, err := Collect(ctx, it)
 	if err != nil {
-		return respBody, err
+		return d, err
 	}
 
-	return respBody, err
+	d.Data.Infos = infos
+	d.Data.PageNumber = 1
+	d.Data.PageSize = len(infos)
 
+	return d, nil
 }
@@ -0,0 +1,187 @@
+package tokencache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/utils"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	fileVersion = 1
+
+	kdfIterations = 200000
+	keyLength     = 32
+	saltLength    = 16
+)
+
+// DefaultPath returns $SS_TOKEN_CACHE, or token.json in the ssctl directory
+// under $XDG_CONFIG_HOME (falling back to ~/.config).
+func DefaultPath() (string, error) {
+
+	if v := os.Getenv("SS_TOKEN_CACHE"); v != "" {
+		return v, nil
+	}
+
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "token.json"), nil
+}
+
+// AccountPath returns the cache of the named account, <account>.json in the
+// tokens directory next to the default cache.
+func AccountPath(account string) (string, error) {
+
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "tokens", account+".json"), nil
+}
+
+func cacheDir() (string, error) {
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configHome, "ssctl"), nil
+}
+
+// FileStore is a sunsynk.TokenStore persisting the token to a file readable
+// only by the current user. When Passphrase is set the token is encrypted
+// with AES-256-GCM using a key derived from it.
+type FileStore struct {
+	Path       string
+	Passphrase string
+}
+
+// cacheFile is the on-disk layout. Exactly one of Token and Ciphertext is set.
+type cacheFile struct {
+	Version    int                  `json:"version"`
+	Token      *sunsynk.SSAuthToken `json:"token,omitempty"`
+	Salt       []byte               `json:"salt,omitempty"`
+	Nonce      []byte               `json:"nonce,omitempty"`
+	Ciphertext []byte               `json:"ciphertext,omitempty"`
+}
+
+func (s FileStore) LoadToken(ctx context.Context) (sunsynk.SSAuthToken, error) {
+
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sunsynk.SSAuthToken{}, sunsynk.ErrNoToken
+	}
+	if err != nil {
+		return sunsynk.SSAuthToken{}, err
+	}
+
+	var f cacheFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return sunsynk.SSAuthToken{}, fmt.Errorf("token cache %s: %w", s.Path, err)
+	}
+
+	if f.Token != nil {
+		return *f.Token, nil
+	}
+
+	if s.Passphrase == "" {
+		return sunsynk.SSAuthToken{}, fmt.Errorf("token cache %s is encrypted, set SS_TOKEN_PASSPHRASE", s.Path)
+	}
+
+	gcm, err := newGCM(s.Passphrase, f.Salt)
+	if err != nil {
+		return sunsynk.SSAuthToken{}, err
+	}
+
+	plaintext, err := gcm.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return sunsynk.SSAuthToken{}, fmt.Errorf("token cache %s: wrong passphrase or corrupt file", s.Path)
+	}
+
+	var token sunsynk.SSAuthToken
+	if err := json.Unmarshal(plaintext, &token); err != nil {
+		return sunsynk.SSAuthToken{}, err
+	}
+
+	return token, nil
+}
+
+func (s FileStore) SaveToken(ctx context.Context, token sunsynk.SSAuthToken) error {
+
+	f := cacheFile{Version: fileVersion}
+
+	if s.Passphrase == "" {
+		f.Token = &token
+	} else {
+		f.Salt = make([]byte, saltLength)
+		if _, err := rand.Read(f.Salt); err != nil {
+			return err
+		}
+
+		gcm, err := newGCM(s.Passphrase, f.Salt)
+		if err != nil {
+			return err
+		}
+
+		f.Nonce = make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(f.Nonce); err != nil {
+			return err
+		}
+
+		plaintext, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		f.Ciphertext = gcm.Seal(nil, f.Nonce, plaintext, nil)
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(s.Path, data, 0600)
+}
+
+// Remove deletes the cache file if it exists.
+func (s FileStore) Remove() error {
+	err := os.Remove(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+
+	if len(salt) != saltLength {
+		return nil, fmt.Errorf("invalid token cache salt")
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, kdfIterations, keyLength, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,89 @@
+package tokencache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ssctl/pkg/sunsynk"
+)
+
+func TestFileStore(t *testing.T) {
+
+	ctx := context.Background()
+	token := sunsynk.SSAuthToken{AccessToken: "access", RefreshToken: "refresh", TokenExpiry: "3600", Timestamp: "1700000000"}
+
+	tests := []struct {
+		name       string
+		passphrase string
+	}{
+		{"plain", ""},
+		{"encrypted", "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			store := FileStore{Path: filepath.Join(t.TempDir(), "ssctl", "token.json"), Passphrase: tt.passphrase}
+
+			if _, err := store.LoadToken(ctx); !errors.Is(err, sunsynk.ErrNoToken) {
+				t.Fatalf("LoadToken before save: err = %v, want ErrNoToken", err)
+			}
+
+			if err := store.SaveToken(ctx, token); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat(store.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Errorf("cache mode = %o, want 600", perm)
+			}
+
+			data, err := os.ReadFile(store.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encrypted := !strings.Contains(string(data), "access"); encrypted != (tt.passphrase != "") {
+				t.Errorf("cache holds the token in the clear: %s", data)
+			}
+
+			got, err := store.LoadToken(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != token {
+				t.Errorf("LoadToken = %+v, want %+v", got, token)
+			}
+
+			if err := store.Remove(); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Remove(); err != nil {
+				t.Errorf("Remove of a missing cache: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStoreWrongPassphrase(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "token.json")
+
+	if err := (FileStore{Path: path, Passphrase: "right"}).SaveToken(ctx, sunsynk.SSAuthToken{AccessToken: "access"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (FileStore{Path: path, Passphrase: "wrong"}).LoadToken(ctx); err == nil || errors.Is(err, sunsynk.ErrNoToken) {
+		t.Errorf("LoadToken with the wrong passphrase: err = %v, want a decryption error", err)
+	}
+	if _, err := (FileStore{Path: path}).LoadToken(ctx); err == nil || errors.Is(err, sunsynk.ErrNoToken) {
+		t.Errorf("LoadToken without a passphrase: err = %v, want an error", err)
+	}
+}
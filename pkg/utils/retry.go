@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy controls how transient HTTP failures are retried. A request is
+// retried on connection resets, timeouts, 429 and 5xx responses. Requests
+// that are not idempotent, such as the token grant and InfluxDB writes, may
+// already have been acted on when those happen, so they are only retried
+// when the server could not have: a refused connection, or a 429 or 503
+// response with Retry-After.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first one.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter randomises each backoff by +/- this fraction (0 to 1).
+	Jitter float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+}
+
+// Retry is the policy set by the --retry-* flags for the API, InfluxDB and
+// Vault clients.
+var Retry = DefaultRetryPolicy
+
+// HTTPStatusError is returned when the server answers with a non-2xx status
+// once all retries are exhausted. Body holds the raw response so callers can
+// decode API specific error envelopes.
+type HTTPStatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s %s: HTTP request failed with status code %d", e.Method, e.URL, e.StatusCode)
+}
+
+// Do sends the request built by newRequest, retrying according to the
+// policy. newRequest is called once per attempt so request bodies can be
+// replayed. The response body is returned for 2xx responses.
+func (p RetryPolicy) Do(ctx context.Context, client *http.Client, newRequest func() (*http.Request, error)) ([]byte, error) {
+
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		body, retryAfter, err := send(client, req)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil || !retryable(req.Method, err, retryAfter) || attempt == attempts {
+			break
+		}
+
+		wait := p.backoff(attempt)
+		if retryAfter > 0 {
+			wait = p.limit(retryAfter)
+		}
+
+		log.Warnf("%v, retrying in %s (attempt %d/%d)", err, wait.Round(time.Millisecond), attempt+1, attempts)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, lastErr
+		case <-timer.C:
+		}
+	}
+
+	return nil, lastErr
+}
+
+func send(client *http.Client, req *http.Request) ([]byte, time.Duration, error) {
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), &HTTPStatusError{
+			Method:     req.Method,
+			URL:        req.URL.Redacted(),
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       body,
+		}
+	}
+
+	return body, 0, nil
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+
+	d := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		delta := float64(d) * p.Jitter
+		d = time.Duration(float64(d) - delta + rand.Float64()*2*delta)
+	}
+
+	return d
+}
+
+// limit caps a server requested delay at MaxBackoff, so that a large
+// Retry-After cannot stall a command or daemon tick.
+func (p RetryPolicy) limit(d time.Duration) time.Duration {
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+
+	return d
+}
+
+func retryable(method string, err error, retryAfter time.Duration) bool {
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		if !idempotent(method) {
+			return retryAfter > 0 && (statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable)
+		}
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	if !idempotent(method) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func idempotent(method string) bool {
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// parseRetryAfter understands both forms of the header: delay-seconds and
+// an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Minute, Jitter: 0.2}
+
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(1); got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("backoff(1) = %s, want within 20%% of 1s", got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+		// approx allows for the time passing while an HTTP date is parsed.
+		approx bool
+	}{
+		{"empty", "", 0, false},
+		{"seconds", "120", 2 * time.Minute, false},
+		{"zero", "0", 0, false},
+		{"negative", "-5", 0, false},
+		{"garbage", "soon", 0, false},
+		{"future date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Hour, true},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.value)
+			if tt.approx {
+				if got < tt.want-2*time.Second || got > tt.want {
+					t.Errorf("parseRetryAfter(%q) = %s, want about %s", tt.value, got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+
+	policy := RetryPolicy{MaxBackoff: 30 * time.Second}
+
+	if got := policy.limit(24 * time.Hour); got != 30*time.Second {
+		t.Errorf("limit(24h) = %s, want 30s", got)
+	}
+	if got := policy.limit(10 * time.Second); got != 10*time.Second {
+		t.Errorf("limit(10s) = %s, want 10s", got)
+	}
+	if got := (RetryPolicy{}).limit(time.Hour); got != time.Hour {
+		t.Errorf("limit without MaxBackoff = %s, want 1h", got)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryable(t *testing.T) {
+
+	status := func(code int) error { return &HTTPStatusError{StatusCode: code} }
+	refused := &url.Error{Op: "Post", URL: "http://x", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	reset := &url.Error{Op: "Get", URL: "http://x", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	timeout := &url.Error{Op: "Get", URL: "http://x", Err: timeoutError{}}
+
+	tests := []struct {
+		method     string
+		err        error
+		retryAfter time.Duration
+		want       bool
+	}{
+		{http.MethodGet, status(500), 0, true},
+		{http.MethodGet, status(503), 0, true},
+		{http.MethodGet, status(429), 0, true},
+		{http.MethodGet, status(404), 0, false},
+		{http.MethodGet, status(401), 0, false},
+		{http.MethodGet, reset, 0, true},
+		{http.MethodGet, timeout, 0, true},
+		{http.MethodGet, refused, 0, true},
+		{http.MethodGet, errors.New("other"), 0, false},
+
+		{http.MethodPost, status(500), 0, false},
+		{http.MethodPost, status(503), 0, false},
+		{http.MethodPost, status(503), time.Second, true},
+		{http.MethodPost, status(429), time.Second, true},
+		{http.MethodPost, status(502), time.Second, false},
+		{http.MethodPost, reset, 0, false},
+		{http.MethodPost, timeout, 0, false},
+		{http.MethodPost, refused, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v %s", tt.method, tt.err, tt.retryAfter), func(t *testing.T) {
+			if got := retryable(tt.method, tt.err, tt.retryAfter); got != tt.want {
+				t.Errorf("retryable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+	tests := []struct {
+		name       string
+		method     string
+		statuses   []int
+		retryAfter string
+		wantCalls  int
+		wantErr    bool
+	}{
+		{"get succeeds", http.MethodGet, []int{200}, "", 1, false},
+		{"get retried", http.MethodGet, []int{502, 500, 200}, "", 3, false},
+		{"get gives up", http.MethodGet, []int{500, 500, 500}, "", 3, true},
+		{"get not found", http.MethodGet, []int{404}, "", 1, true},
+		{"post not retried", http.MethodPost, []int{500, 200}, "", 1, true},
+		{"post retried with retry-after", http.MethodPost, []int{503, 200}, "1", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[calls]
+				calls++
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+				w.Write([]byte("ok"))
+			}))
+			defer server.Close()
+
+			// Retry-After: 1 is capped at MaxBackoff, keeping the test fast.
+			start := time.Now()
+			body, err := policy.Do(context.Background(), server.Client(), func() (*http.Request, error) {
+				return http.NewRequest(tt.method, server.URL, strings.NewReader("x"))
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && string(body) != "ok" {
+				t.Errorf("body = %q, want ok", body)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("took %s, Retry-After not capped", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Package vault keeps the Sunsynk credentials and tokens in the KV version 2
+// secrets engine of HashiCorp Vault, using its HTTP API.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/utils"
+)
+
+const (
+	// DefaultMount is the mount of the KV engine unless configured.
+	DefaultMount = "secret"
+	// DefaultPath is the path the secrets are kept under unless configured.
+	DefaultPath = "ssctl"
+)
+
+// ErrNotFound is returned when a secret does not exist.
+var ErrNotFound = errors.New("vault secret not found")
+
+// Client talks to one Vault server.
+type Client struct {
+	Address string
+	Token   string
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace  string
+	HTTPClient *http.Client
+	Retry      utils.RetryPolicy
+}
+
+// NewClientFromEnv returns a client configured like the vault CLI, from
+// VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE. Without VAULT_TOKEN the token
+// of `vault login` in ~/.vault-token is used.
+func NewClientFromEnv() (*Client, error) {
+
+	client := &Client{
+		Address:    os.Getenv("VAULT_ADDR"),
+		Token:      os.Getenv("VAULT_TOKEN"),
+		Namespace:  os.Getenv("VAULT_NAMESPACE"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Retry:      utils.DefaultRetryPolicy,
+	}
+
+	if client.Address == "" {
+		return nil, fmt.Errorf("vault address not set, set VAULT_ADDR")
+	}
+
+	if client.Token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if token, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				client.Token = strings.TrimSpace(string(token))
+			}
+		}
+	}
+	if client.Token == "" {
+		return nil, fmt.Errorf("vault token not set, set VAULT_TOKEN or run vault login")
+	}
+
+	return client, nil
+}
+
+// Read returns the latest version of the KV secret at path of mount.
+func (c *Client) Read(ctx context.Context, mount, path string) (map[string]string, error) {
+
+	endpoint, err := c.endpoint(mount, path)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.do(ctx, http.MethodGet, endpoint, nil)
+
+	var statusErr *utils.HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("vault %s/%s: %w", mount, path, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vault %s/%s: %w", mount, path, err)
+	}
+
+	var resp struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("vault %s/%s: %w", mount, path, err)
+	}
+
+	return resp.Data.Data, nil
+}
+
+// Write stores data as a new version of the KV secret at path of mount.
+func (c *Client) Write(ctx context.Context, mount, path string, data map[string]string) error {
+
+	endpoint, err := c.endpoint(mount, path)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.do(ctx, http.MethodPost, endpoint, body); err != nil {
+		return fmt.Errorf("vault %s/%s: %w", mount, path, err)
+	}
+
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, body []byte) ([]byte, error) {
+
+	return c.Retry.Do(ctx, c.HTTPClient, func() (*http.Request, error) {
+
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("X-Vault-Token", c.Token)
+		req.Header.Set("X-Vault-Request", "true")
+		if c.Namespace != "" {
+			req.Header.Set("X-Vault-Namespace", c.Namespace)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		return req, nil
+	})
+}
+
+// endpoint returns the KV v2 data URL of path.
+func (c *Client) endpoint(mount, path string) (string, error) {
+
+	base, err := url.Parse(strings.TrimSuffix(c.Address, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid vault address: %w", err)
+	}
+
+	base.Path += "/v1/" + strings.Trim(mount, "/") + "/data/" + strings.Trim(path, "/")
+
+	return base.String(), nil
+}
+
+// Store keeps the credentials of one account at <Path>/credentials, with
+// the username and password keys, and its token at <Path>/token, with the
+// keys of the Kubernetes token secret.
+type Store struct {
+	Client *Client
+	Mount  string
+	Path   string
+}
+
+// Credentials reads the username and password, making the store a
+// sunsynk.CredentialStore.
+func (s *Store) Credentials(ctx context.Context) (string, string, error) {
+
+	data, err := s.Client.Read(ctx, s.Mount, s.Path+"/credentials")
+	if err != nil {
+		return "", "", err
+	}
+
+	if data["username"] == "" || data["password"] == "" {
+		return "", "", fmt.Errorf("vault %s/%s/credentials: username or password not found in secret data", s.Mount, s.Path)
+	}
+
+	return data["username"], data["password"], nil
+}
+
+// LoadToken reads the token, making the store a sunsynk.TokenStore.
+func (s *Store) LoadToken(ctx context.Context) (sunsynk.SSAuthToken, error) {
+
+	data, err := s.Client.Read(ctx, s.Mount, s.Path+"/token")
+	if errors.Is(err, ErrNotFound) {
+		return sunsynk.SSAuthToken{}, sunsynk.ErrNoToken
+	}
+	if err != nil {
+		return sunsynk.SSAuthToken{}, err
+	}
+
+	return sunsynk.TokenFromMap(data), nil
+}
+
+// SaveToken writes token as a new version of the token secret.
+func (s *Store) SaveToken(ctx context.Context, token sunsynk.SSAuthToken) error {
+	return s.Client.Write(ctx, s.Mount, s.Path+"/token", token.Map())
+}
@@ -0,0 +1,258 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"ssctl/pkg/sunsynk"
+	"ssctl/pkg/utils"
+)
+
+// fakeKV is a Vault server with a KV version 2 engine mounted at secret.
+type fakeKV struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	secrets map[string]map[string]string
+	// bodies holds the raw body of every write, by path.
+	bodies map[string]map[string]interface{}
+	fail   bool
+}
+
+func newFakeKV(t *testing.T) (*fakeKV, *Client) {
+
+	kv := &fakeKV{t: t, secrets: map[string]map[string]string{}, bodies: map[string]map[string]interface{}{}}
+
+	server := httptest.NewServer(kv)
+	t.Cleanup(server.Close)
+
+	client := &Client{
+		Address:    server.URL + "/",
+		Token:      "root",
+		Namespace:  "team",
+		HTTPClient: server.Client(),
+		Retry:      utils.RetryPolicy{MaxAttempts: 1},
+	}
+
+	return kv, client
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "root" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	if r.Header.Get("X-Vault-Namespace") != "team" {
+		kv.t.Errorf("namespace header = %q", r.Header.Get("X-Vault-Namespace"))
+	}
+	if kv.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"errors":["internal error"]}`))
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/v1/secret/data/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := kv.secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"request_id": "1",
+			"data": map[string]interface{}{
+				"data":     data,
+				"metadata": map[string]interface{}{"version": 1},
+			},
+		})
+
+	case http.MethodPost, http.MethodPut:
+		var raw map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		data := map[string]string{}
+		fields, _ := raw["data"].(map[string]interface{})
+		for k, v := range fields {
+			data[k], _ = v.(string)
+		}
+
+		kv.bodies[path] = raw
+		kv.secrets[path] = data
+		w.Write([]byte(`{"data":{"version":1}}`))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+
+	kv, client := newFakeKV(t)
+	ctx := context.Background()
+
+	if _, err := client.Read(ctx, "secret", "ssctl/token"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read of a missing secret: err = %v, want ErrNotFound", err)
+	}
+
+	data := map[string]string{"username": "user@example.com", "password": "p@ss"}
+	if err := client.Write(ctx, "/secret/", "/ssctl/credentials/", data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes are wrapped in the data object of the KV v2 API.
+	want := map[string]interface{}{"data": map[string]interface{}{"username": "user@example.com", "password": "p@ss"}}
+	if !reflect.DeepEqual(kv.bodies["ssctl/credentials"], want) {
+		t.Errorf("write body = %v, want %v", kv.bodies["ssctl/credentials"], want)
+	}
+
+	// Reads unwrap data.data and ignore the metadata.
+	got, err := client.Read(ctx, "secret", "ssctl/credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("Read = %v, want %v", got, data)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+
+	kv, client := newFakeKV(t)
+	ctx := context.Background()
+	kv.secrets["ssctl/token"] = map[string]string{"token": "a"}
+
+	// Failures other than a missing secret are not reported as one.
+	kv.fail = true
+	_, err := client.Read(ctx, "secret", "ssctl/token")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Read with a failing server: err = %v", err)
+	}
+	kv.fail = false
+
+	client.Token = "wrong"
+	_, err = client.Read(ctx, "secret", "ssctl/token")
+	var statusErr *utils.HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Read with a wrong token: err = %v, want a 403", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+
+	kv, client := newFakeKV(t)
+	ctx := context.Background()
+	store := &Store{Client: client, Mount: "secret", Path: "ssctl/acme"}
+
+	if _, err := store.LoadToken(ctx); !errors.Is(err, sunsynk.ErrNoToken) {
+		t.Fatalf("LoadToken of a missing token: err = %v, want ErrNoToken", err)
+	}
+
+	token := sunsynk.SSAuthToken{
+		AccessToken:  "access",
+		TokenType:    "bearer",
+		RefreshToken: "refresh",
+		TokenExpiry:  "3600",
+		Scope:        "all",
+		Timestamp:    "1700000000",
+	}
+	if err := store.SaveToken(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if kv.secrets["ssctl/acme/token"]["token"] != "access" {
+		t.Errorf("token secret = %v", kv.secrets["ssctl/acme/token"])
+	}
+
+	got, err := store.LoadToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != token {
+		t.Errorf("LoadToken = %+v, want %+v", got, token)
+	}
+
+	kv.fail = true
+	if _, err := store.LoadToken(ctx); err == nil || errors.Is(err, sunsynk.ErrNoToken) {
+		t.Errorf("LoadToken with a failing server: err = %v", err)
+	}
+	kv.fail = false
+
+	if _, _, err := store.Credentials(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Credentials of missing secret: err = %v, want ErrNotFound", err)
+	}
+
+	kv.secrets["ssctl/acme/credentials"] = map[string]string{"username": "user"}
+	if _, _, err := store.Credentials(ctx); err == nil {
+		t.Error("Credentials without a password did not fail")
+	}
+
+	kv.secrets["ssctl/acme/credentials"]["password"] = "pass"
+	user, pass, err := store.Credentials(ctx)
+	if err != nil || user != "user" || pass != "pass" {
+		t.Errorf("Credentials = %q, %q, %v", user, pass, err)
+	}
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("VAULT_NAMESPACE", "")
+
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "root")
+	if _, err := NewClientFromEnv(); err == nil {
+		t.Error("NewClientFromEnv without VAULT_ADDR did not fail")
+	}
+
+	t.Setenv("VAULT_ADDR", "http://127.0.0.1:8200")
+	t.Setenv("VAULT_TOKEN", "")
+	if _, err := NewClientFromEnv(); err == nil {
+		t.Error("NewClientFromEnv without a token did not fail")
+	}
+
+	// The token of vault login is used without VAULT_TOKEN.
+	if err := os.WriteFile(filepath.Join(home, ".vault-token"), []byte("from-login\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClientFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Token != "from-login" {
+		t.Errorf("token = %q, want from-login", client.Token)
+	}
+
+	t.Setenv("VAULT_TOKEN", "root")
+	client, err = NewClientFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Token != "root" {
+		t.Errorf("token = %q, want root", client.Token)
+	}
+}